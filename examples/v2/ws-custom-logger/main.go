@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/op/go-logging"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
 	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
 	"github.com/vx416/bitfinex-api-go/v2/websocket"
 )
@@ -22,9 +23,10 @@ func main() {
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 	logging.SetBackend(backendFormatter)
 
-	// create websocket client and pass logger
+	// create websocket client and pass logger, logger.NewSlog adapts a
+	// log/slog logger instead
 	p := websocket.NewDefaultParameters()
-	p.Logger = log
+	p.Log = logger.NewGoLogging(log)
 	client := websocket.NewWithParams(p)
 	err := client.Connect()
 	if err != nil {
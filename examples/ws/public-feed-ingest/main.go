@@ -137,6 +137,8 @@ func main() {
 				log.Printf("%T: %+v\n", v, v)
 			case *status.LiquidationsSnapshot:
 				log.Printf("%T: %+v\n", v, v)
+			case *status.LiquidationsUpdate:
+				log.Printf("%T: %+v\n", v, v)
 			default:
 				log.Printf("raw/unrecognized msg: %T: %s\n", v, v)
 			}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/op/go-logging"
+)
+
+type goLogging struct {
+	l      *logging.Logger
+	fields []Field
+}
+
+// NewGoLogging adapts a go-logging logger, fields are appended to the message.
+func NewGoLogging(l *logging.Logger) Logger {
+	return &goLogging{l: l}
+}
+
+func (g *goLogging) message(format string, args []interface{}) string {
+	return fmt.Sprintf(format, args...) + formatFields(g.fields)
+}
+
+func (g *goLogging) Debugf(format string, args ...interface{}) {
+	g.l.Debug(g.message(format, args))
+}
+
+func (g *goLogging) Infof(format string, args ...interface{}) {
+	g.l.Info(g.message(format, args))
+}
+
+func (g *goLogging) Warningf(format string, args ...interface{}) {
+	g.l.Warning(g.message(format, args))
+}
+
+func (g *goLogging) Errorf(format string, args ...interface{}) {
+	g.l.Error(g.message(format, args))
+}
+
+func (g *goLogging) With(fields ...Field) Logger {
+	return &goLogging{l: g.l, fields: withFields(g.fields, fields)}
+}
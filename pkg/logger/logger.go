@@ -0,0 +1,121 @@
+// Package logger defines the logging interface used by the websocket, rest and
+// mux clients, with adapters for go-logging, log/slog and the std log package.
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Field keys used by the clients.
+const (
+	KeySocketID = "socket_id"
+	KeyChanID   = "chan_id"
+	KeySubID    = "sub_id"
+	KeySymbol   = "symbol"
+)
+
+// Field is a key value pair attached to every entry of a logger.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// SocketID creates a field with the id of a websocket connection.
+func SocketID(id int) Field {
+	return F(KeySocketID, id)
+}
+
+// ChanID creates a field with the id of a websocket channel.
+func ChanID(id int64) Field {
+	return F(KeyChanID, id)
+}
+
+// SubID creates a field with the id of a websocket subscription.
+func SubID(id string) Field {
+	return F(KeySubID, id)
+}
+
+// Symbol creates a field with a trading or funding symbol.
+func Symbol(symbol string) Field {
+	return F(KeySymbol, symbol)
+}
+
+// Logger is a leveled logger with structured fields.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// With returns a logger adding the given fields to every entry.
+	With(fields ...Field) Logger
+}
+
+// formatFields renders fields as " key=value" pairs appended to text entries
+func formatFields(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	return b.String()
+}
+
+func withFields(fields []Field, more []Field) []Field {
+	all := make([]Field, 0, len(fields)+len(more))
+	all = append(all, fields...)
+	return append(all, more...)
+}
+
+type nop struct{}
+
+// Nop returns a logger discarding all entries.
+func Nop() Logger {
+	return nop{}
+}
+
+func (nop) Debugf(format string, args ...interface{})   {}
+func (nop) Infof(format string, args ...interface{})    {}
+func (nop) Warningf(format string, args ...interface{}) {}
+func (nop) Errorf(format string, args ...interface{})   {}
+func (n nop) With(fields ...Field) Logger               { return n }
+
+type std struct {
+	l      *log.Logger
+	fields []Field
+}
+
+// NewStd adapts a logger of the std log package, entries are prefixed with
+// their level.
+func NewStd(l *log.Logger) Logger {
+	return &std{l: l}
+}
+
+func (s *std) print(level, format string, args []interface{}) {
+	s.l.Printf("[%s] %s%s", level, fmt.Sprintf(format, args...), formatFields(s.fields))
+}
+
+func (s *std) Debugf(format string, args ...interface{}) {
+	s.print("DEBUG", format, args)
+}
+
+func (s *std) Infof(format string, args ...interface{}) {
+	s.print("INFO", format, args)
+}
+
+func (s *std) Warningf(format string, args ...interface{}) {
+	s.print("WARN", format, args)
+}
+
+func (s *std) Errorf(format string, args ...interface{}) {
+	s.print("ERROR", format, args)
+}
+
+func (s *std) With(fields ...Field) Logger {
+	return &std{l: s.l, fields: withFields(s.fields, fields)}
+}
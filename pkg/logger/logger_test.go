@@ -0,0 +1,46 @@
+package logger_test
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+)
+
+func TestRedact(t *testing.T) {
+	t.Run("auth message", func(t *testing.T) {
+		msg := `{"subId":"1","event":"auth","apiKey":"key","authSig":"sig","authPayload":"AUTH1","authNonce":"1"}`
+		got := logger.Redact(msg)
+		assert.Equal(t, `{"subId":"1","event":"auth","apiKey":"[REDACTED]","authSig":"[REDACTED]","authPayload":"[REDACTED]","authNonce":"1"}`, got)
+	})
+
+	t.Run("token", func(t *testing.T) {
+		got := logger.Redact(`{"event":"auth", "token" : "secret"}`)
+		assert.Equal(t, `{"event":"auth", "token" : "[REDACTED]"}`, got)
+	})
+
+	t.Run("other messages untouched", func(t *testing.T) {
+		msg := `[5,[[9000,1,1]]]`
+		assert.Equal(t, msg, logger.Redact(msg))
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		headers := map[string]string{"bfx-apikey": "key", "bfx-signature": "sig", "bfx-nonce": "1"}
+		got := logger.RedactHeaders(headers)
+		assert.Equal(t, map[string]string{"bfx-apikey": "[REDACTED]", "bfx-signature": "[REDACTED]", "bfx-nonce": "1"}, got)
+		assert.Equal(t, "key", headers["bfx-apikey"])
+	})
+}
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.NewStd(log.New(&buf, "", 0))
+	l.With(logger.SocketID(1), logger.ChanID(5)).Warningf("sequence gap: expected %d", 3)
+	assert.Equal(t, "[WARN] sequence gap: expected 3 socket_id=1 chan_id=5\n", buf.String())
+
+	buf.Reset()
+	l.Infof("connected")
+	assert.Equal(t, "[INFO] connected\n", buf.String())
+}
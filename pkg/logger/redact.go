@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in log entries.
+const Redacted = "[REDACTED]"
+
+// names of the message fields and headers carrying credentials
+var sensitive = []string{"apiKey", "authSig", "authPayload", "token", "bfx-apikey", "bfx-signature"}
+
+var redactPattern = regexp.MustCompile(`("(?:` + strings.Join(sensitive, "|") + `)"\s*:\s*)"[^"]*"`)
+
+// Redact masks API keys, signatures, auth payloads and tokens in a JSON message.
+func Redact(msg string) string {
+	return redactPattern.ReplaceAllString(msg, `${1}"`+Redacted+`"`)
+}
+
+// IsSensitive reports whether a message field or header carries credentials.
+func IsSensitive(key string) bool {
+	for _, s := range sensitive {
+		if strings.EqualFold(s, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders returns a copy of the headers with credentials masked.
+func RedactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if IsSensitive(k) {
+			v = Redacted
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
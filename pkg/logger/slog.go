@@ -0,0 +1,51 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+type slogger struct {
+	l *slog.Logger
+}
+
+// NewSlog adapts a log/slog logger, fields become attributes. Warningf logs at
+// slog.LevelWarn.
+func NewSlog(l *slog.Logger) Logger {
+	return &slogger{l: l}
+}
+
+func (s *slogger) log(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (s *slogger) Debugf(format string, args ...interface{}) {
+	s.log(slog.LevelDebug, format, args)
+}
+
+func (s *slogger) Infof(format string, args ...interface{}) {
+	s.log(slog.LevelInfo, format, args)
+}
+
+func (s *slogger) Warningf(format string, args ...interface{}) {
+	s.log(slog.LevelWarn, format, args)
+}
+
+func (s *slogger) Errorf(format string, args ...interface{}) {
+	s.log(slog.LevelError, format, args)
+}
+
+func (s *slogger) With(fields ...Field) Logger {
+	attrs := make([]interface{}, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	return &slogger{l: s.l.With(attrs...)}
+}
@@ -0,0 +1,33 @@
+//go:build go1.21
+
+package logger_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := logger.NewSlog(slog.New(handler))
+
+	l.With(logger.SubID("7"), logger.Symbol("tBTCUSD")).Warningf("checksum %d invalid", 42)
+	assert.Equal(t, "level=WARN msg=\"checksum 42 invalid\" sub_id=7 symbol=tBTCUSD\n", buf.String())
+
+	buf.Reset()
+	l.Debugf("below level")
+	assert.Equal(t, "", buf.String())
+}
@@ -0,0 +1,56 @@
+// Package metrics defines the metrics sink used by the websocket, rest and mux
+// clients and a registry serving the collected metrics in the Prometheus text
+// exposition format.
+package metrics
+
+// Metrics recorded by the clients and their labels.
+const (
+	// counter: socket_id, channel, symbol
+	WsMessages = "bfx_ws_messages_total"
+	// counter of reconnect attempts: socket_id, result
+	WsReconnects = "bfx_ws_reconnects_total"
+	// counter: socket_id, private
+	WsSequenceGaps = "bfx_ws_sequence_gaps_total"
+	// gauge: socket_id
+	WsSubscriptions = "bfx_ws_subscriptions"
+	// histogram: socket_id
+	WsPingRTT = "bfx_ws_ping_rtt_seconds"
+	// gauge of messages waiting to be written to a connection
+	WsWriteQueue = "bfx_ws_write_queue_depth"
+
+	// counter: endpoint, method, symbol, status
+	RestRequests = "bfx_rest_requests_total"
+	// histogram: endpoint, method
+	RestLatency = "bfx_rest_request_duration_seconds"
+
+	// counter: client, channel
+	MuxMessages = "bfx_mux_messages_total"
+	// counter: client
+	MuxReconnects = "bfx_mux_reconnects_total"
+	// gauge
+	MuxPublicClients = "bfx_mux_public_clients"
+	// gauge of subscribe calls within the rate limit window
+	MuxRateLimitQueue = "bfx_mux_rate_limit_queue_depth"
+)
+
+// Labels are the dimensions of a single series of a metric.
+type Labels map[string]string
+
+// Sink receives the metrics recorded by the clients. Implementations must be
+// safe for concurrent use.
+type Sink interface {
+	IncCounter(name string, labels Labels, delta float64)
+	SetGauge(name string, labels Labels, value float64)
+	Observe(name string, labels Labels, value float64)
+}
+
+type nop struct{}
+
+// Nop returns a sink discarding all metrics.
+func Nop() Sink {
+	return nop{}
+}
+
+func (nop) IncCounter(name string, labels Labels, delta float64) {}
+func (nop) SetGauge(name string, labels Labels, value float64)   {}
+func (nop) Observe(name string, labels Labels, value float64)    {}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets in seconds.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type kind int
+
+const (
+	counter kind = iota
+	gauge
+	histogram
+)
+
+func (k kind) String() string {
+	switch k {
+	case gauge:
+		return "gauge"
+	case histogram:
+		return "histogram"
+	}
+	return "counter"
+}
+
+type series struct {
+	labels Labels
+	value  float64
+	counts []uint64 // per bucket, histograms only
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	kind   kind
+	series map[string]*series
+}
+
+// Registry is a Sink keeping the current value of every series in memory,
+// served in the Prometheus text exposition format by Handler.
+type Registry struct {
+	lock     sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+// NewRegistry creates a registry using DefaultBuckets for histograms.
+func NewRegistry() *Registry {
+	return NewRegistryWithBuckets(DefaultBuckets)
+}
+
+// NewRegistryWithBuckets creates a registry with the given histogram bucket
+// upper bounds.
+func NewRegistryWithBuckets(buckets []float64) *Registry {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &Registry{buckets: sorted, families: make(map[string]*family)}
+}
+
+// series returns the series of a metric, nil if the metric exists with another kind
+func (r *Registry) series(name string, k kind, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: k, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	if f.kind != k {
+		return nil
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: copyLabels(labels)}
+		if k == histogram {
+			s.counts = make([]uint64, len(r.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (r *Registry) IncCounter(name string, labels Labels, delta float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s := r.series(name, counter, labels); s != nil {
+		s.value += delta
+	}
+}
+
+func (r *Registry) SetGauge(name string, labels Labels, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s := r.series(name, gauge, labels); s != nil {
+		s.value = value
+	}
+}
+
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.series(name, histogram, labels)
+	if s == nil {
+		return
+	}
+	for i, le := range r.buckets {
+		if value <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Write writes all metrics in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	bw := bufio.NewWriter(w)
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogram {
+				fmt.Fprintf(bw, "%s%s %s\n", name, key, formatValue(s.value))
+				continue
+			}
+			for i, le := range r.buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(withLabel(s.labels, "le", formatValue(le))), s.counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(withLabel(s.labels, "le", "+Inf")), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, key, formatValue(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, key, s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func copyLabels(labels Labels) Labels {
+	c := make(Labels, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+func withLabel(labels Labels, key, value string) Labels {
+	c := copyLabels(labels)
+	c[key] = value
+	return c
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders labels sorted by name, empty if there are none
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, k, labelEscaper.Replace(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
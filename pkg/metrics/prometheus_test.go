@@ -0,0 +1,54 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("text exposition", func(t *testing.T) {
+		r := metrics.NewRegistryWithBuckets([]float64{0.1, 1})
+		r.IncCounter(metrics.WsMessages, metrics.Labels{"socket_id": "0", "channel": "book", "symbol": "tBTCUSD"}, 1)
+		r.IncCounter(metrics.WsMessages, metrics.Labels{"socket_id": "0", "channel": "book", "symbol": "tBTCUSD"}, 2)
+		r.SetGauge(metrics.WsSubscriptions, metrics.Labels{"socket_id": "0"}, 3)
+		r.SetGauge(metrics.WsSubscriptions, metrics.Labels{"socket_id": "0"}, 2)
+		r.Observe(metrics.WsPingRTT, nil, 0.05)
+		r.Observe(metrics.WsPingRTT, nil, 0.5)
+		// a metric keeps the kind it was first recorded with
+		r.SetGauge(metrics.WsMessages, nil, 1)
+
+		expected := `# TYPE bfx_ws_messages_total counter
+bfx_ws_messages_total{channel="book",socket_id="0",symbol="tBTCUSD"} 3
+# TYPE bfx_ws_ping_rtt_seconds histogram
+bfx_ws_ping_rtt_seconds_bucket{le="0.1"} 1
+bfx_ws_ping_rtt_seconds_bucket{le="1"} 2
+bfx_ws_ping_rtt_seconds_bucket{le="+Inf"} 2
+bfx_ws_ping_rtt_seconds_sum 0.55
+bfx_ws_ping_rtt_seconds_count 2
+# TYPE bfx_ws_subscriptions gauge
+bfx_ws_subscriptions{socket_id="0"} 2
+`
+		srv := httptest.NewServer(r.Handler())
+		defer srv.Close()
+		resp, err := srv.Client().Get(srv.URL)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		assert.Equal(t, expected, string(body))
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("escapes label values", func(t *testing.T) {
+		r := metrics.NewRegistry()
+		r.IncCounter(metrics.RestRequests, metrics.Labels{"endpoint": "a\"b\\c"}, 1)
+		w := httptest.NewRecorder()
+		require.Nil(t, r.Write(w))
+		assert.Equal(t, "# TYPE bfx_rest_requests_total counter\nbfx_rest_requests_total{endpoint=\"a\\\"b\\\\c\"} 1\n", w.Body.String())
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strings"
 
 	"github.com/vx416/bitfinex-api-go/pkg/convert"
 	"github.com/vx416/bitfinex-api-go/pkg/models/common"
@@ -56,6 +57,20 @@ func SnapshotFromRaw(symbol, precision string, raw [][]interface{}, rawNumbers i
 	return &Snapshot{Snapshot: snap}, nil
 }
 
+// BulkUpdate is a batch of book updates delivered in a single frame when the
+// BULK_UPDATES conf flag is enabled.
+type BulkUpdate struct {
+	Updates []*Book
+}
+
+func BulkUpdateFromRaw(symbol, precision string, raw [][]interface{}, rawNumbers interface{}) (*BulkUpdate, error) {
+	snap, err := SnapshotFromRaw(symbol, precision, raw, rawNumbers)
+	if err != nil {
+		return nil, err
+	}
+	return &BulkUpdate{Updates: snap.Snapshot}, nil
+}
+
 func IsRawBook(precision string) bool {
 	return precision == "R0"
 }
@@ -205,3 +220,8 @@ func fundingPairsBook(raw []interface{}, rawNumbers interface{}) *Book {
 		AmountJsNum: convert.FloatToJsonNumber(rawNumSlice[3]),
 	}
 }
+
+// IsFundingBook returns true if the symbol belongs to a funding book.
+func IsFundingBook(symbol string) bool {
+	return strings.HasPrefix(symbol, common.FundingPrefix)
+}
@@ -108,3 +108,30 @@ func TestNewBookFromRaw(t *testing.T) {
 		assert.Equal(t, expected, b)
 	})
 }
+
+func TestBulkUpdateFromRaw(t *testing.T) {
+	t.Run("empty frame", func(t *testing.T) {
+		b, err := book.BulkUpdateFromRaw("tBTCUSD", "P0", [][]interface{}{}, []interface{}{})
+		require.NotNil(t, err)
+		require.Nil(t, b)
+	})
+
+	t.Run("valid trading updates", func(t *testing.T) {
+		payload := [][]interface{}{
+			{9000.5, 1, 0.5},
+			{9001.5, 0, -1.0},
+		}
+		rawNums := []interface{}{
+			[]interface{}{9000.5, 1, 0.5},
+			[]interface{}{9001.5, 0, -1.0},
+		}
+
+		b, err := book.BulkUpdateFromRaw("tBTCUSD", "P0", payload, rawNums)
+		require.Nil(t, err)
+		require.Len(t, b.Updates, 2)
+		assert.Equal(t, common.Bid, b.Updates[0].Side)
+		assert.Equal(t, book.BookEntry, b.Updates[0].Action)
+		assert.Equal(t, common.Ask, b.Updates[1].Side)
+		assert.Equal(t, book.BookRemoveEntry, b.Updates[1].Action)
+	})
+}
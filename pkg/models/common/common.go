@@ -11,6 +11,9 @@ const (
 	OrderFlagPostOnly             int              = 4096
 	OrderFlagOCO                  int              = 16384
 	Checksum                      int              = 131072
+	SeqAll                        int              = 65536
+	Timestamp                     int              = 32768
+	BulkUpdates                   int              = 536870912
 	OrderStatusActive                              = "ACTIVE"
 	OrderStatusExecuted                            = "EXECUTED"
 	OrderStatusPartiallyFilled                     = "PARTIALLY FILLED"
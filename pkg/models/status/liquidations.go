@@ -21,6 +21,16 @@ type Liquidation struct {
 	PriceAcquired float64
 }
 
+// Matched reports whether the position was matched by the liquidation engine
+func (l *Liquidation) Matched() bool {
+	return l.IsMatch == 1
+}
+
+// MarketSold reports whether the position was sold on the market
+func (l *Liquidation) MarketSold() bool {
+	return l.IsMarketSold == 1
+}
+
 func LiqFromRaw(raw []interface{}) (*Liquidation, error) {
 	if len(raw) < 12 {
 		return nil, fmt.Errorf("data slice too short for liquidation status: %#v", raw)
@@ -53,3 +63,17 @@ func LiqSnapshotFromRaw(raw [][]interface{}) (*LiquidationsSnapshot, error) {
 	}
 	return &LiquidationsSnapshot{Snapshot: snapshot}, nil
 }
+
+// LiquidationsUpdate is a batch of liquidations delivered in a single frame
+// after the snapshot of the subscription.
+type LiquidationsUpdate struct {
+	Updates []*Liquidation
+}
+
+func LiqUpdateFromRaw(raw [][]interface{}) (*LiquidationsUpdate, error) {
+	snap, err := LiqSnapshotFromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &LiquidationsUpdate{Updates: snap.Snapshot}, nil
+}
@@ -138,3 +138,17 @@ func TestLiqSnapshotFromRaw(t *testing.T) {
 		})
 	}
 }
+
+func TestLiqUpdateFromRaw(t *testing.T) {
+	_, err := status.LiqUpdateFromRaw([][]interface{}{})
+	assert.Error(t, err)
+
+	got, err := status.LiqUpdateFromRaw([][]interface{}{
+		{"pos", 145400868, 1609144352338, nil, "tETHF0:USTF0", -1.67288094, 730.96, nil, 1, 1, nil, 736.13},
+		{"pos", 145400869, 1609144352339, nil, "tBTCF0:USTF0", 0.5, 28000, nil, 0, 0, nil, nil},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, got.Updates, 2)
+	assert.Equal(t, "tETHF0:USTF0", got.Updates[0].Symbol)
+	assert.Equal(t, int64(145400869), got.Updates[1].PositionID)
+}
@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
 	"github.com/vx416/bitfinex-api-go/pkg/models/event"
 	"github.com/vx416/bitfinex-api-go/pkg/mux/client"
 	"github.com/vx416/bitfinex-api-go/pkg/mux/msg"
@@ -35,6 +37,8 @@ type Mux struct {
 	authURL            string
 	online             bool
 	rateLimitQueueSize int
+	log                logger.Logger
+	metrics            metrics.Sink
 }
 
 // api rate limit is 20 calls per minute. 1x3s, 20x1min
@@ -54,6 +58,8 @@ func New() *Mux {
 		subInfo:       map[int64]event.Info{},
 		publicURL:     "wss://api-pub.bitfinex.com/ws/2",
 		authURL:       "wss://api.bitfinex.com/ws/2",
+		log:           logger.NewStd(log.Default()),
+		metrics:       metrics.Nop(),
 	}
 }
 
@@ -94,6 +100,19 @@ func (m *Mux) WithAuthURL(url string) *Mux {
 	return m
 }
 
+// WithLogger accepts and persists logger, the std log package is used by default
+func (m *Mux) WithLogger(l logger.Logger) *Mux {
+	m.log = l
+	return m
+}
+
+// WithMetrics accepts and persists the sink receiving message, reconnect and
+// rate limit metrics
+func (m *Mux) WithMetrics(sink metrics.Sink) *Mux {
+	m.metrics = sink
+	return m
+}
+
 func (m *Mux) IsConnected() bool {
 	return m.online
 }
@@ -128,11 +147,12 @@ func (m *Mux) Subscribe(sub event.Subscribe) *Mux {
 	}
 
 	if limitReached := m.publicClients[m.cid].SubsLimitReached(); limitReached {
-		log.Printf("subs limit is reached on cid: %d, spawning new conn\n", m.cid)
+		m.log.Infof("subs limit is reached on cid: %d, spawning new conn", m.cid)
 		m.addPublicClient()
 	}
 
 	m.rateLimitQueueSize++
+	m.metrics.SetGauge(metrics.MuxRateLimitQueue, nil, float64(m.rateLimitQueueSize))
 	return m
 }
 
@@ -169,11 +189,13 @@ func (m *Mux) Listen(cb func(interface{}, error)) error {
 			}
 			// return raw payload data if transform is off
 			if !m.transform {
+				m.recordMessage("public", "raw")
 				cb(ms.Data, nil)
 				continue
 			}
 			// handle event type message
 			if ms.IsEvent() {
+				m.recordMessage("public", "event")
 				cb(m.recordEvent(ms.ProcessEvent()))
 				continue
 			}
@@ -190,6 +212,7 @@ func (m *Mux) Listen(cb func(interface{}, error)) error {
 					cb(nil, fmt.Errorf("unrecognized chanId:%d", chID))
 					continue
 				}
+				m.recordMessage("public", inf.Channel)
 				cb(ms.ProcessPublic(raw, pld, chID, inf))
 				continue
 			}
@@ -205,11 +228,13 @@ func (m *Mux) Listen(cb func(interface{}, error)) error {
 			}
 			// return raw payload data if transform is off
 			if !m.transform {
+				m.recordMessage("private", "raw")
 				cb(ms.Data, nil)
 				continue
 			}
 			// handle event type message
 			if ms.IsEvent() {
+				m.recordMessage("private", "event")
 				cb(m.recordEvent(ms.ProcessEvent()))
 				continue
 			}
@@ -220,6 +245,7 @@ func (m *Mux) Listen(cb func(interface{}, error)) error {
 					cb(nil, err)
 					continue
 				}
+				m.recordMessage("private", "auth")
 				cb(ms.ProcessPrivate(raw, pld, chID, msgType))
 				continue
 			}
@@ -233,13 +259,13 @@ func (m *Mux) Listen(cb func(interface{}, error)) error {
 					continue
 				}
 				if err := v.Close(); err != nil {
-					log.Printf("failed closing public client: %s\n", err)
+					m.log.Errorf("failed closing public client: %s", err)
 				}
 			}
 
 			if m.privateClient != nil {
 				if err := m.privateClient.Close(); err != nil {
-					log.Printf("failed closing private client: %s\n", err)
+					m.log.Errorf("failed closing private client: %s", err)
 				}
 			}
 
@@ -276,21 +302,28 @@ func (m *Mux) recordEvent(i event.Info, err error) (event.Info, error) {
 	return i, err
 }
 
+func (m *Mux) recordMessage(client, channel string) {
+	m.metrics.IncCounter(metrics.MuxMessages, metrics.Labels{"client": client, "channel": channel}, 1)
+}
+
 func (m *Mux) resetPublicClient(cid int) {
+	m.metrics.IncCounter(metrics.MuxReconnects, metrics.Labels{"client": "public"}, 1)
 	// pull old client subscriptions
 	subs := m.publicClients[cid].GetAllSubs()
 	// add fresh client
 	m.addPublicClient()
 	// resubscribe old events
 	for _, sub := range subs {
-		log.Printf("resubscribing: %+v\n", sub)
+		m.log.With(logger.Symbol(sub.Symbol)).Infof("resubscribing: %+v", sub)
 		m.Subscribe(sub)
 	}
 	// remove old, closed channel from the list
 	delete(m.publicClients, cid)
+	m.metrics.SetGauge(metrics.MuxPublicClients, nil, float64(len(m.publicClients)))
 }
 
 func (m *Mux) resetPrivateClient() {
+	m.metrics.IncCounter(metrics.MuxReconnects, metrics.Labels{"client": "private"}, 1)
 	m.authenticated = false
 	m.privateClient = nil
 	m.addPrivateClient()
@@ -311,6 +344,7 @@ func (m *Mux) addPublicClient() *Mux {
 	}
 	// add new client to list for later reference
 	m.publicClients[m.cid] = c
+	m.metrics.SetGauge(metrics.MuxPublicClients, nil, float64(len(m.publicClients)))
 	// start listening for incoming client messages
 	go c.Read(m.publicChan)
 	return m
@@ -336,6 +370,7 @@ func (m *Mux) watchRateLimit() {
 		for {
 			if m.rateLimitQueueSize > 0 {
 				m.rateLimitQueueSize--
+				m.metrics.SetGauge(metrics.MuxRateLimitQueue, nil, float64(m.rateLimitQueueSize))
 			}
 
 			time.Sleep(rateLimitDuration)
@@ -2,7 +2,9 @@ package tests
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/vx416/bitfinex-api-go/pkg/models/balanceinfo"
@@ -39,6 +41,9 @@ type listener struct {
 	orderNew             chan *order.New
 	orderUpdate          chan *order.Update
 	errors               chan error
+	events               chan interface{} // messages without a typed channel, read with next
+	lock                 sync.Mutex
+	held                 []interface{} // events skipped by next
 }
 
 func newListener() *listener {
@@ -53,6 +58,7 @@ func newListener() *listener {
 		walletSnapshot:       make(chan *wallet.Snapshot, 10),
 		positionSnapshot:     make(chan *position.Snapshot, 10),
 		errors:               make(chan error, 10),
+		events:               make(chan interface{}, 1000),
 		notifications:        make(chan *notification.Notification, 10),
 		positions:            make(chan *position.Update, 10),
 		tradeUpdates:         make(chan *tradeexecutionupdate.TradeExecutionUpdate, 10),
@@ -332,7 +338,44 @@ func (l *listener) nextTick() (*ticker.Ticker, error) {
 // 	}
 // }
 
-// strongly types messages and places them into a channel
+// next returns the first event for which match returns true, skipped events
+// stay queued for later calls
+func (l *listener) next(match func(interface{}) bool) (interface{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i, ev := range l.held {
+		if match(ev) {
+			l.held = append(l.held[:i], l.held[i+1:]...)
+			return ev, nil
+		}
+	}
+	timeout := time.After(time.Second * 2)
+	for {
+		select {
+		case ev := <-l.events:
+			if match(ev) {
+				return ev, nil
+			}
+			l.held = append(l.held, ev)
+		case <-timeout:
+			return nil, errors.New("timed out waiting for event")
+		}
+	}
+}
+
+// nextOf returns the next event of type T
+func nextOf[T any](l *listener) (T, error) {
+	ev, err := l.next(func(ev interface{}) bool {
+		_, ok := ev.(T)
+		return ok
+	})
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("timed out waiting for %T", zero)
+	}
+	return ev.(T), nil
+}
+
 func (l *listener) run(ch <-chan interface{}) {
 	go func() {
 		// nolint:megacheck
@@ -386,7 +429,7 @@ func (l *listener) run(ch <-chan interface{}) {
 				case *wallet.Snapshot:
 					l.walletSnapshot <- msg.(*wallet.Snapshot)
 				default:
-					log.Printf("COULD NOT TYPE MSG ^")
+					l.events <- msg
 				}
 			}
 		}
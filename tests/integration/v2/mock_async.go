@@ -31,6 +31,28 @@ func newTestAsyncFactory(async websocket.Asynchronous) websocket.AsynchronousFac
 	return &TestAsyncFactory{Async: async, Count: 0}
 }
 
+// TestAsyncPool creates a new async for every connection and keeps them, so
+// tests can drive each connection of a client
+type TestAsyncPool struct {
+	lock   sync.Mutex
+	asyncs []*TestAsync
+}
+
+func (t *TestAsyncPool) Create() websocket.Asynchronous {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	async := newTestAsync()
+	t.asyncs = append(t.asyncs, async)
+	return async
+}
+
+// get returns the async of the i-th created connection
+func (t *TestAsyncPool) get(i int) *TestAsync {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.asyncs[i]
+}
+
 type TestAsync struct {
 	done      chan error
 	bridge    chan []byte
@@ -45,6 +67,13 @@ func (t *TestAsync) SentCount() int {
 	return len(t.Sent)
 }
 
+// sentAt returns a sent message while the client may still be sending
+func (t *TestAsync) sentAt(i int) interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.Sent[i]
+}
+
 func (t *TestAsync) waitForMessage(num int) error {
 	seconds := 4
 	loops := 20
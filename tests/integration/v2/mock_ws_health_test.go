@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+func TestPingHealth(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.PingInterval = time.Millisecond * 100
+	p.PongTimeout = time.Second
+	p.ReconnectInterval = time.Millisecond * 10
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// answer the first ping
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.PingRequest{Event: "ping", CID: 1}, async.sentAt(0))
+	async.Publish(`{"event":"pong","ts":1511545528111,"cid":1}`)
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// only pongs to pings of the user are published
+	async.Publish(`{"event":"pong","ts":1511545528222,"cid":42}`)
+	pong, err := nextOf[*websocket.PongEvent](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, int64(42), pong.CID)
+
+	h := ws.Health()
+	assert(t, 1, len(h.Sockets))
+	assert(t, 1, h.Sockets[0].Ping.Samples)
+	if h.Sockets[0].Ping.P50 <= 0 || h.Sockets[0].Ping.P50 != h.Sockets[0].Ping.Max {
+		t.Fatalf("unexpected ping stats %#v", h.Sockets[0].Ping)
+	}
+	if h.Sockets[0].LastMessage.IsZero() {
+		t.Fatal("expected last message time")
+	}
+	assert(t, 0, h.Reconnects)
+
+	// missing pongs restart the connection
+	deadline := time.Now().Add(time.Second * 3)
+	for ws.Health().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected reconnect after missing pong")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	h = ws.Health()
+	assert(t, 1, h.Sockets[0].Reconnects)
+	assert(t, 0, h.Sockets[0].Ping.Samples)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+func TestMetrics(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	reg := metrics.NewRegistry()
+	p := websocket.NewDefaultParameters()
+	p.Metrics = reg
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// subscribe
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// tick data
+	for i := 0; i < 2; i++ {
+		async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+		if _, err := listener.nextTick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := writeMetrics(t, reg)
+	expectMetric(t, out, `bfx_ws_messages_total{channel="ticker",socket_id="0",symbol="tBTCUSD"} 2`)
+	expectMetric(t, out, `bfx_ws_subscriptions{socket_id="0"} 1`)
+
+	// unsubscribe
+	if err := ws.Unsubscribe(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"unsubscribed","chanId":5,"status":"OK"}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	expectMetric(t, writeMetrics(t, reg), `bfx_ws_subscriptions{socket_id="0"} 0`)
+}
+
+func writeMetrics(t *testing.T, reg *metrics.Registry) string {
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func expectMetric(t *testing.T, out, line string) {
+	if !strings.Contains(out, line+"\n") {
+		t.Fatalf("expected metric %s in:\n%s", line, out)
+	}
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+func TestPositionTracker(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManagePositions = true
+	p.PositionThresholds = websocket.PositionThresholds{LiquidationDistance: 0.05}
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// new long position with 5x leverage
+	async.Publish(`[0,"pn",["tBTCUSD","ACTIVE",1,10000,0,0,null,null,9000,5,null,142355652,1574002216000,1574002216000,null,0,null,0,0,null]]`)
+
+	// tracker subscribes to the ticker for the position symbol
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	req := async.sentAt(1).(*websocket.SubscriptionRequest)
+	assert(t, websocket.ChanTicker, req.Channel)
+	assert(t, "tBTCUSD", req.Symbol)
+
+	// updates of the position reuse the feed
+	async.Publish(`[0,"pu",["tBTCUSD","ACTIVE",1,10000,0,0,null,null,9000,5,null,142355652,1574002216000,1574002216000,null,0,null,0,0,null]]`)
+
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + req.SubID + `","pair":"BTCUSD"}`)
+	async.Publish(`[5,[9399,1,9401,1,-600,-0.06,9400,1000,10100,9300]]`)
+
+	alert, err := nextOf[*websocket.PositionAlert](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, websocket.PositionAlertLiquidation, alert.Kind)
+	assert(t, true, alert.Breached)
+	assert(t, 2, async.SentCount())
+
+	tp, err := ws.GetTrackedPosition("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 9400.0, tp.MarkPrice)
+	assert(t, -600.0, tp.UnrealizedPnL)
+	if math.Abs(tp.EffectiveLeverage-9400.0/1400.0) > 1e-9 {
+		t.Fatalf("unexpected effective leverage %f", tp.EffectiveLeverage)
+	}
+
+	// closing the position stops tracking it
+	async.Publish(`[0,"pc",["tBTCUSD","CLOSED",0,10000,0,0,null,null,9000,5,null,142355652,1574002216000,1574002216000,null,0,null,0,0,null]]`)
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.GetTrackedPosition("tBTCUSD"); err == nil {
+		t.Fatal("expected closed position to no longer be tracked")
+	}
+}
+
+// positionRaw returns a position message payload of the given symbol, status and amount
+func positionRaw(symbol, status string, amount float64) string {
+	a, _ := json.Marshal(amount)
+	return `["` + symbol + `","` + status + `",` + string(a) + `,10000,0,0,null,null,9000,5,null,142355652,1574002216000,1574002216000,null,0,null,0,0,null]`
+}
+
+// sentJSON returns the marshalled request sent at the given position
+func sentJSON(t *testing.T, async *TestAsync, pos int) string {
+	if err := async.waitForMessage(pos); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(async.sentAt(pos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestPositionTrackerReleasesFeeds(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManagePositions = true
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an update closing the position releases its feed without subscribing again
+	async.Publish(`[0,"pn",` + positionRaw("tBTCUSD", "ACTIVE", 1) + `]`)
+	req := waitForRequest(t, async, 1)
+	assert(t, "tBTCUSD", req.Symbol)
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + req.SubID + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[0,"pu",` + positionRaw("tBTCUSD", "CLOSED", 0) + `]`)
+	assert(t, `{"event":"unsubscribe","chanId":5}`, sentJSON(t, async, 2))
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":5}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a snapshot releases the feeds of missing positions and only subscribes
+	// the feeds of open ones
+	async.Publish(`[0,"pn",` + positionRaw("tETHUSD", "ACTIVE", 2) + `]`)
+	req = waitForRequest(t, async, 3)
+	assert(t, "tETHUSD", req.Symbol)
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":6,"symbol":"tETHUSD","subId":"` + req.SubID + `","pair":"ETHUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[0,"ps",[` + positionRaw("tLTCUSD", "ACTIVE", 3) + `,` + positionRaw("tXRPUSD", "CLOSED", 0) + `]]`)
+	sent := []string{sentJSON(t, async, 4), sentJSON(t, async, 5)}
+	sort.Strings(sent)
+	assert(t, `{"event":"unsubscribe","chanId":6}`, sent[0])
+	ltc := &websocket.SubscriptionRequest{}
+	if err := json.Unmarshal([]byte(sent[1]), ltc); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "tLTCUSD", ltc.Symbol)
+	time.Sleep(time.Millisecond * 50)
+	assert(t, 6, async.SentCount())
+	if _, err := ws.GetTrackedPosition("tETHUSD"); err == nil {
+		t.Fatal("expected position missing from the snapshot to no longer be tracked")
+	}
+}
@@ -1,11 +1,15 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/vx416/bitfinex-api-go/pkg/models/balanceinfo"
+	"github.com/vx416/bitfinex-api-go/pkg/models/order"
 	"github.com/vx416/bitfinex-api-go/pkg/models/wallet"
+	"github.com/vx416/bitfinex-api-go/v2/rest"
 	"github.com/vx416/bitfinex-api-go/v2/websocket"
 )
 
@@ -61,6 +65,100 @@ func TestAuthentication(t *testing.T) {
 	assert(t, expected2.ChanID, actual2.ChanID)
 }
 
+func TestAuthenticationOptions(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).WithAuthOptions(websocket.AuthOptions{
+		Filter:             []string{websocket.AuthFilterWallet, websocket.TradingFilter("tBTCUSD")},
+		CancelOnDisconnect: websocket.Bool(true),
+		Calc:               websocket.Bool(true),
+		Token:              "authTokenXYZ",
+	})
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// token auth request without key & signature
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err.Error())
+	}
+	actual := async.Sent[0].(*websocket.SubscriptionRequest)
+	assert(t, "auth", actual.Event)
+	assert(t, "authTokenXYZ", actual.Token)
+	assert(t, "", actual.APIKey)
+	assert(t, "", actual.AuthSig)
+	assert(t, 2, len(actual.Filter))
+	assert(t, "wallet", actual.Filter[0])
+	assert(t, "trading-tBTCUSD", actual.Filter[1])
+	assert(t, websocket.DMSCancelOnDisconnect, actual.DMS)
+	assert(t, 1, actual.Calc)
+
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	av, err := listener.nextAuthEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "OK", av.Status)
+	if _, err := ws.GetAuthenticatedSocket(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthenticationOptionsCompose(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client, auth options only change the options set
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).
+		Credentials("apiKeyABC", "apiSecretXYZ").
+		CancelOnDisconnect(true).
+		WithAuthOptions(websocket.AuthOptions{Filter: []string{websocket.AuthFilterWallet}})
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err.Error())
+	}
+	actual := async.Sent[0].(*websocket.SubscriptionRequest)
+	assert(t, "auth", actual.Event)
+	assert(t, "apiKeyABC", actual.APIKey)
+	assert(t, 1, len(actual.Filter))
+	assert(t, "wallet", actual.Filter[0])
+	assert(t, websocket.DMSCancelOnDisconnect, actual.DMS)
+	assert(t, 0, actual.Calc)
+}
+
 func TestWalletBalanceUpdates(t *testing.T) {
 	// create transport & nonce mocks
 	async := newTestAsync()
@@ -643,3 +741,445 @@ func TestWalletBalanceUpdates(t *testing.T) {
 // 	}
 // 	fmt.Println(*authSocket)
 // }
+
+func TestCalcRequests(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.CalcThrottle = time.Millisecond * 200
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).
+		Credentials("apiKeyABC", "apiSecretXYZ").
+		WithAuthOptions(websocket.AuthOptions{Calc: websocket.Bool(true)})
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// first request is sent right away
+	if err := ws.RequestMarginBaseCalc(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.CalcRequest{Keys: []string{"margin_base"}}, async.Sent[1])
+
+	// requests within the throttle interval are merged
+	if err := ws.RequestPositionCalc(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	res := make(chan interface{})
+	go func() {
+		obj, err := ws.AwaitCalc(context.Background(), websocket.CalcWallet("margin", "USD"))
+		if err != nil {
+			res <- err
+			return
+		}
+		res <- obj
+	}()
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	if async.SentCount() != 3 {
+		t.Fatalf("expected 3 sent messages but got %d", async.SentCount())
+	}
+	req := async.Sent[2].(*websocket.CalcRequest)
+	assert(t, 2, len(req.Keys))
+	assert(t, "position_tBTCUSD", req.Keys[0])
+	assert(t, "wallet_margin_USD", req.Keys[1])
+	b, err := req.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0, "calc", null, [["position_tBTCUSD"],["wallet_margin_USD"]]]`, string(b))
+
+	// the awaited update is returned and published
+	async.Publish(`[0,"wu",["exchange","USD",80000,0,80000,null,null,null]]`)
+	async.Publish(`[0,"wu",["margin","USD",10000,0,10000,null,null,null]]`)
+	select {
+	case obj := <-res:
+		wu, ok := obj.(*wallet.Update)
+		if !ok {
+			t.Fatalf("expected wallet update but got %#v", obj)
+		}
+		assert(t, "margin", wu.Type)
+		assert(t, 10000.0, wu.Balance)
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for calc result")
+	}
+}
+
+func TestCalcRequestsRejected(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client without calc enabled
+	p := websocket.NewDefaultParameters()
+	p.CalcThrottle = time.Hour
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server would ignore the request, awaiting it fails right away
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := ws.AwaitCalc(ctx, websocket.CalcMarginBase); err != websocket.ErrCalcDisabled {
+		t.Fatalf("expected ErrCalcDisabled but got %v", err)
+	}
+
+	// requests are rejected once the client is closed, nothing is sent
+	ws.WithAuthOptions(websocket.AuthOptions{Calc: websocket.Bool(true)})
+	ws.Close()
+	if err := ws.RequestMarginBaseCalc(context.Background()); err != websocket.ErrWSNotConnected {
+		t.Fatalf("expected ErrWSNotConnected but got %v", err)
+	}
+	if async.SentCount() != 1 {
+		t.Fatalf("expected only the auth request to be sent but got %d messages", async.SentCount())
+	}
+}
+
+func TestOrderMulti(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	multi, err := ws.SubmitOrderMulti(context.Background(), rest.OrderOps{
+		{"on", order.NewRequest{CID: 123, Type: "EXCHANGE LIMIT", Symbol: "tBTCUSD", Amount: 1, Price: 900}},
+		{"oc", map[string]int{"id": 1149686139}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(1); err != nil {
+		t.Fatal(err)
+	}
+	b, err := async.Sent[1].(*websocket.OrderMultiRequest).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0, "ox_multi", null, [["on",{"gid":0,"cid":123,"type":"EXCHANGE LIMIT","symbol":"tBTCUSD","amount":"1","price":"900"}],["oc",{"id":1149686139}]]]`, string(b))
+
+	// notifications are correlated regardless of their order
+	async.Publish(`[0,"n",[null,"oc-req",null,null,[1149686139,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitted for cancellation; waiting for confirmation (ID: 1149686139)."]]`)
+	async.Publish(`[0,"n",[null,"on-req",null,null,[null,null,123,"tBTCUSD",null,null,1,1,"EXCHANGE LIMIT",null,null,null,null,null,null,null,900,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null],null,"ERROR","Invalid order: not enough exchange balance"]]`)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	results, err := multi.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(results))
+	assert(t, "on", results[0].Op)
+	assert(t, "on-req", results[0].Notification.Type)
+	if results[0].Err == nil {
+		t.Fatal("expected rejected order op to carry an error")
+	}
+	assert(t, "oc", results[1].Op)
+	assert(t, "SUCCESS", results[1].Notification.Status)
+	if results[1].Err != nil {
+		t.Fatal(results[1].Err)
+	}
+
+	// cancel all orders
+	cm, err := ws.CancelMulti(context.Background(), rest.CancelOrderMultiRequest{All: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(2); err != nil {
+		t.Fatal(err)
+	}
+	b, err = async.Sent[2].(*websocket.CancelMultiRequest).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `[0, "oc_multi", null, {"all":1}]`, string(b))
+	async.Publish(`[0,"n",[1568711312683,"oc_multi-req",null,null,[],null,"SUCCESS","Submitting 2 order cancellations."]]`)
+	results, err = cm.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "oc_multi", results[0].Op)
+	assert(t, "SUCCESS", results[0].Notification.Status)
+
+	// concurrent cancels are correlated by the cancelled orders
+	cm5, err := ws.CancelMulti(context.Background(), rest.CancelOrderMultiRequest{OrderIDs: rest.OrderIDs{5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm6, err := ws.CancelMulti(context.Background(), rest.CancelOrderMultiRequest{OrderIDs: rest.OrderIDs{6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[0,"n",[1568711312683,"oc_multi-req",null,null,[[6,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null]],null,"SUCCESS","Submitting 1 order cancellations."]]`)
+	results, err = cm6.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "oc_multi", results[0].Op)
+	select {
+	case r := <-cm5.Results():
+		t.Fatalf("unexpected result for another cancel: %#v", r)
+	default:
+	}
+
+	// ops are no longer tracked once waiting timed out
+	short, cancelShort := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancelShort()
+	if _, err := cm5.Wait(short); err == nil {
+		t.Fatal("expected wait to time out")
+	}
+	retry, err := ws.SubmitOrderMulti(context.Background(), rest.OrderOps{{"oc", map[string]int{"id": 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`[0,"n",[1568711312683,"oc_multi-req",null,null,[[5,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null]],null,"SUCCESS","Submitting 1 order cancellations."]]`)
+	async.Publish(`[0,"n",[null,"oc-req",null,null,[5,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,null,0,null,null,null,null,null,null,null,null],null,"SUCCESS","Submitted for cancellation; waiting for confirmation (ID: 5)."]]`)
+	results, err = retry.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "oc", results[0].Op)
+	select {
+	case r := <-cm5.Results():
+		t.Fatalf("unexpected result after timeout: %#v", r)
+	default:
+	}
+
+	// ops without identifiers cannot be correlated
+	if _, err := ws.SubmitOrderMulti(context.Background(), rest.OrderOps{{"on", order.NewRequest{Symbol: "tBTCUSD", Amount: 1, Price: 900}}}); err == nil {
+		t.Fatal("expected an error for an op without cid")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ReconnectInterval = time.Millisecond * 10
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// order requests are paused during maintenance
+	async.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode. Please pause any activity and resume after receiving the info message 20061"}`)
+	if _, err := nextOf[*websocket.MaintenanceStarted](listener); err != nil {
+		t.Fatal(err)
+	}
+	onr := &order.NewRequest{CID: 123, Type: "EXCHANGE LIMIT", Symbol: "tBTCUSD", Amount: 1, Price: 900}
+	if err := ws.SubmitOrder(context.Background(), onr); err != websocket.ErrMaintenance {
+		t.Fatalf("expected maintenance error but got %v", err)
+	}
+
+	// public channels are resubscribed once maintenance ends
+	pre := async.SentCount()
+	async.Publish(`{"event":"info","code":20061,"msg":"Maintenance ended. You can resume normal activity. It is advised to unsubscribe/subscribe again all channels."}`)
+	if _, err := nextOf[*websocket.MaintenanceEnded](listener); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+	sub, ok := async.sentAt(pre + 1).(*websocket.SubscriptionRequest)
+	if !ok {
+		t.Fatalf("expected resubscribe request but got %#v", async.sentAt(pre+1))
+	}
+	assert(t, "subscribe", sub.Event)
+	assert(t, "ticker", sub.Channel)
+	if err := ws.SubmitOrder(context.Background(), onr); err != nil {
+		t.Fatal(err)
+	}
+
+	// server restart reconnects the socket
+	async.Publish(`{"event":"info","code":20051,"msg":"Stopping. Please try to reconnect"}`)
+	deadline := time.Now().Add(time.Second * 2)
+	for ws.Health().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected reconnect after server restart")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func TestMaintenanceEndedWhileReconnecting(t *testing.T) {
+	// create transport & nonce mocks, reconnects use a new transport
+	pool := &TestAsyncPool{}
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ReconnectInterval = time.Millisecond * 10
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, pool, nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async := pool.get(0)
+	async.Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"info","code":20060,"msg":"Entering in Maintenance mode. Please pause any activity and resume after receiving the info message 20061"}`)
+	if _, err := nextOf[*websocket.MaintenanceStarted](listener); err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection drops before the end of maintenance is announced
+	async.Publish(`{"event":"info","code":20051,"msg":"Stopping. Please try to reconnect"}`)
+	deadline := time.Now().Add(time.Second * 2)
+	for ws.Health().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected reconnect after server restart")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	assert(t, true, ws.InMaintenance())
+
+	// the platform status of the new connection ends maintenance
+	pool.get(1).Publish(`{"event":"info","version":2,"platform":{"status":1}}`)
+	if _, err := nextOf[*websocket.MaintenanceEnded](listener); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, false, ws.InMaintenance())
+}
+
+func TestMaintenanceOnConnect(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce).Credentials("apiKeyABC", "apiSecretXYZ")
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// the platform is in maintenance when connecting
+	async.Publish(`{"event":"info","version":2,"platform":{"status":0}}`)
+	if _, err := nextOf[*websocket.MaintenanceStarted](listener); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, true, ws.InMaintenance())
+	async.Publish(`{"event":"auth","status":"OK","chanId":0,"userId":1,"subId":"nonce1","auth_id":"valid-auth-guid","caps":{"orders":{"read":1,"write":0},"account":{"read":1,"write":0},"funding":{"read":1,"write":0},"history":{"read":1,"write":0},"wallets":{"read":1,"write":0},"withdraw":{"read":0,"write":0},"positions":{"read":1,"write":0}}}`)
+	if _, err := listener.nextAuthEvent(); err != nil {
+		t.Fatal(err)
+	}
+	onr := &order.NewRequest{CID: 123, Type: "EXCHANGE LIMIT", Symbol: "tBTCUSD", Amount: 1, Price: 900}
+	if err := ws.SubmitOrder(context.Background(), onr); err != websocket.ErrMaintenance {
+		t.Fatalf("expected maintenance error but got %v", err)
+	}
+
+	// order requests resume once maintenance ends
+	async.Publish(`{"event":"info","code":20061,"msg":"Maintenance ended. You can resume normal activity. It is advised to unsubscribe/subscribe again all channels."}`)
+	if _, err := nextOf[*websocket.MaintenanceEnded](listener); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, false, ws.InMaintenance())
+	if err := ws.SubmitOrder(context.Background(), onr); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,8 +3,11 @@ package tests
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
 	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/status"
 	"github.com/vx416/bitfinex-api-go/pkg/models/ticker"
 	"github.com/vx416/bitfinex-api-go/v2"
 	"github.com/vx416/bitfinex-api-go/v2/websocket"
@@ -228,3 +231,242 @@ func TestOrderbook(t *testing.T) {
 // 		t.Fatal("Expected socket count to be 6 but got", conCount)
 // 	}
 // }
+
+func TestOrderbookResync(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	p.BookResyncBackoff = time.Millisecond * 50
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	bId, err_st := ws.SubscribeBook(context.Background(), "tBTCUSD", common.Precision1, common.FrequencyTwoPerSecond, 100)
+	if err_st != nil {
+		t.Fatal(err_st)
+	}
+	async.Publish(`{"event":"conf","status":"OK","flags":131072}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":100,"symbol":"tBTCUSD","prec":"P1","freq":"F1","len":"100","subId":"` + bId + `","pair":"BTCUSD"}`)
+	async.Publish(`[100,[[9000,1,1],[9010,1,-1]]]`)
+	async.Publish(`[100,"hb"]`)
+
+	ob, err := ws.GetOrderbook("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 1, len(ob.Bids()))
+
+	// invalid checksum drops the subscription and resubscribes immediately
+	pre := async.SentCount()
+	async.Publish(`[100,"cs",1]`)
+	resync, err := nextOf[*websocket.BookResync](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "tBTCUSD", resync.Symbol)
+	assert(t, bId, resync.OldSubID)
+	assert(t, 1, resync.ConsecutiveMismatches)
+	assert(t, time.Duration(0), resync.Backoff)
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+	req := async.Sent[pre+1].(*websocket.SubscriptionRequest)
+	assert(t, resync.NewSubID, req.SubID)
+	assert(t, string(common.Precision1), req.Precision)
+	assert(t, string(common.FrequencyTwoPerSecond), req.Frequency)
+	assert(t, "100", req.Len)
+	// stale book is discarded
+	assert(t, 0, len(ob.Bids())+len(ob.Asks()))
+
+	// mismatches until unsubscribed don't resync again
+	async.Publish(`[100,"cs",1]`)
+	async.Publish(`[100,"hb"]`)
+	stats := ws.GetBookChecksumStats("tBTCUSD", common.Precision1)
+	assert(t, int64(2), stats.Mismatches)
+	assert(t, int64(1), stats.Resyncs)
+	assert(t, 1, stats.ConsecutiveMismatches)
+	assert(t, pre+2, async.SentCount())
+
+	// the new snapshot rebuilds the same book
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":100}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":101,"symbol":"tBTCUSD","prec":"P1","freq":"F1","len":"100","subId":"` + req.SubID + `","pair":"BTCUSD"}`)
+	async.Publish(`[101,[[9001,1,2],[9011,1,-2]]]`)
+	// heartbeat is only read once the snapshot has been handled
+	async.Publish(`[101,"hb"]`)
+	bid, ok := ob.BestBid()
+	assert(t, true, ok)
+	assert(t, 9001.0, bid.Price)
+
+	// repeated mismatch resubscribes after the backoff
+	pre = async.SentCount()
+	async.Publish(`[101,"cs",1]`)
+	resync, err = nextOf[*websocket.BookResync](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, resync.ConsecutiveMismatches)
+	assert(t, p.BookResyncBackoff, resync.Backoff)
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats = ws.GetBookChecksumStats("tBTCUSD", common.Precision1)
+	assert(t, int64(3), stats.Mismatches)
+	assert(t, int64(2), stats.Resyncs)
+	assert(t, 2, stats.ConsecutiveMismatches)
+}
+
+func TestBulkBookUpdates(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	p.BulkBookUpdates = true
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: common.Checksum | common.BulkUpdates}, async.Sent[0])
+	async.Publish(`{"event":"conf","status":"OK","flags":537001984}`)
+
+	id, err := ws.SubscribeBook(context.Background(), "tBTCUSD", common.Precision0, common.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + id + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first frame is still a snapshot
+	async.Publish(`[5,[[7000,1,1],[6999,2,3],[7001,1,-1],[7002,1,-2]]]`)
+	// following arrays are batches of updates
+	async.Publish(`[5,[[7000,0,1],[6998,1,4],[7001,2,-1.5]]]`)
+	bulk, err := nextOf[*book.BulkUpdate](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 3, len(bulk.Updates))
+	assert(t, "tBTCUSD", bulk.Updates[0].Symbol)
+	assert(t, 6998.0, bulk.Updates[1].Price)
+
+	// ensure the batch has been applied
+	async.Publish(`[5,"hb"]`)
+	async.Publish(`[5,"hb"]`)
+	ob, err := ws.GetOrderbook("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bids, asks := ob.Bids(), ob.Asks()
+	assert(t, 2, len(bids))
+	assert(t, 6999.0, bids[0].Price)
+	assert(t, 6998.0, bids[1].Price)
+	assert(t, 1.5, asks[0].Amount)
+}
+
+func TestLiquidations(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := ws.SubscribeLiquidations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SubscriptionRequest{SubID: id, Event: "subscribe", Channel: "status", Key: "liq:global"}, async.Sent[0])
+	async.Publish(`{"event":"subscribed","channel":"status","chanId":9,"key":"liq:global","subId":"` + id + `"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshot of recent liquidations
+	async.Publish(`[9,[["pos",145400868,1609144352338,null,"tETHF0:USTF0",-1.67288094,730.96,null,1,1,null,736.13],["pos",145400869,1609144352339,null,"tBTCF0:USTF0",0.5,28000,null,0,0,null,null]]]`)
+	snap, err := nextOf[*status.LiquidationsSnapshot](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(snap.Snapshot))
+	assert(t, "tETHF0:USTF0", snap.Snapshot[0].Symbol)
+
+	// following liquidations are delivered one by one
+	async.Publish(`[9,[["pos",145400870,1609144352400,null,"tBTCF0:USTF0",-0.25,28100.5,null,1,0,null,28050]]]`)
+	liq, err := nextOf[*status.Liquidation](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "tBTCF0:USTF0", liq.Symbol)
+	assert(t, int64(145400870), liq.PositionID)
+	assert(t, -0.25, liq.Amount)
+	assert(t, 28100.5, liq.BasePrice)
+	assert(t, true, liq.Matched())
+	assert(t, false, liq.MarketSold())
+
+	// several liquidations in a frame are an update, not a new snapshot
+	async.Publish(`[9,[["pos",145400871,1609144352500,null,"tETHF0:USTF0",1.5,731.2,null,0,1,null,null],["pos",145400872,1609144352501,null,"tBTCF0:USTF0",-0.1,28090,null,1,1,null,28080]]]`)
+	upd, err := nextOf[*status.LiquidationsUpdate](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(upd.Updates))
+	assert(t, int64(145400871), upd.Updates[0].PositionID)
+	assert(t, "tBTCF0:USTF0", upd.Updates[1].Symbol)
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/ticker"
+	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+func TestSequenceGap(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageSequence = true
+	p.SequenceRecovery = websocket.SequenceRecoveryResubscribe
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	// SEQ_ALL flag requested on open
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: common.SeqAll}, async.Sent[0])
+	async.Publish(`{"event":"conf","status":"OK","flags":65536}`)
+
+	id, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],1]`)
+	seq, err := nextOf[*websocket.Envelope](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, int64(1), seq.Seq)
+	if tick, ok := seq.Message.(*ticker.Ticker); !ok || tick.Symbol != "tBTCUSD" {
+		t.Fatalf("expected ticker but got %#v", seq.Message)
+	}
+	async.Publish(`[5,"hb",2]`)
+
+	// message 3 is lost
+	pre := async.SentCount()
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454],4]`)
+	gap, err := nextOf[*websocket.SequenceGap](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SequenceGap{SocketId: 0, Expected: 3, Received: 4}, gap)
+
+	// recovery resubscribes the ticker
+	if err := async.waitForMessage(pre + 1); err != nil {
+		t.Fatal(err)
+	}
+	req := async.Sent[pre+1].(*websocket.SubscriptionRequest)
+	assert(t, websocket.ChanTicker, req.Channel)
+	assert(t, "tBTCUSD", req.Symbol)
+}
+
+func TestServerTimestamps(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageSequence = true
+	p.ServerTimestamps = true
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.waitForMessage(0); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.FlagRequest{Event: "conf", Flags: common.SeqAll | common.Timestamp}, async.Sent[0])
+	async.Publish(`{"event":"conf","status":"OK","flags":98304}`)
+
+	id, err := ws.SubscribeTrades(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"trades","chanId":7,"symbol":"tBTCUSD","subId":"` + id + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := time.Now().Add(-time.Millisecond * 50)
+	mts := strconv.FormatInt(sent.UnixNano()/int64(time.Millisecond), 10)
+	async.Publish(`[7,"te",[401597395,1574694478808,0.005,7245.3],1,` + mts + `]`)
+	env, err := nextOf[*websocket.Envelope](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, int64(1), env.Seq)
+	assert(t, sent.UnixNano()/int64(time.Millisecond), env.Timestamp.UnixNano()/int64(time.Millisecond))
+	if tr, ok := env.Message.(*trade.Trade); !ok || tr.ID != 401597395 {
+		t.Fatalf("expected trade but got %#v", env.Message)
+	}
+
+	stats, err := ws.MessageLatency(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, int64(1), stats.Samples)
+	if stats.Last < time.Millisecond*50 {
+		t.Fatalf("expected latency of at least 50ms but got %s", stats.Last)
+	}
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+// waitForRequest returns the first subscription request sent from position pos
+func waitForRequest(t *testing.T, async *TestAsync, pos int) *websocket.SubscriptionRequest {
+	deadline := time.Now().Add(time.Second * 2)
+	for time.Now().Before(deadline) {
+		for i := pos; i < async.SentCount(); i++ {
+			if req, ok := async.sentAt(i).(*websocket.SubscriptionRequest); ok {
+				return req
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timed out waiting for subscription request")
+	return nil
+}
+
+func TestRebalance(t *testing.T) {
+	// create transport & nonce mocks
+	pool := &TestAsyncPool{}
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.ManageOrderbook = true
+	p.PingInterval = 0
+	p.ShardingPolicy = websocket.ChannelWeight{}
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, pool, nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async := pool.get(0)
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// all subscriptions start on the only connection
+	btcId, err := ws.SubscribeBook(context.Background(), "tBTCUSD", common.Precision0, common.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethId, err := ws.SubscribeBook(context.Background(), "tETHUSD", common.Precision0, common.FrequencyRealtime, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trdId, err := ws.SubscribeTrades(context.Background(), "tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + btcId + `","pair":"BTCUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"book","chanId":6,"symbol":"tETHUSD","prec":"P0","freq":"F0","len":"25","subId":"` + ethId + `","pair":"ETHUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"trades","chanId":7,"symbol":"tBTCUSD","subId":"` + trdId + `","pair":"BTCUSD"}`)
+	for i := 0; i < 3; i++ {
+		if _, err := listener.nextSubscriptionEvent(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	async.Publish(`[5,[[9000,1,1],[9010,1,-1]]]`)
+	async.Publish(`[6,[[300,1,1],[301,1,-1]]]`)
+
+	err = ws.StartNewConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	async1 := pool.get(1)
+	async1.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// one of the books moves to the new connection
+	pre := async.SentCount()
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		done <- ws.Rebalance(ctx)
+	}()
+	req := waitForRequest(t, async1, 0)
+	assert(t, "tBTCUSD", req.Symbol)
+	assert(t, string(common.Precision0), req.Precision)
+	if req.SubID == btcId {
+		t.Fatal("expected a new subscription ID")
+	}
+	// the new channel reuses the channel ID of the old connection
+	async1.Publish(`{"event":"subscribed","channel":"book","chanId":5,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","subId":"` + req.SubID + `","pair":"BTCUSD"}`)
+	if _, err := listener.nextSubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old subscription keeps the book updated until the new snapshot arrives
+	async.Publish(`[5,[8990,1,2]]`)
+	async.Publish(`[5,"hb"]`)
+	ob, err := ws.GetOrderbook("tBTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(ob.Bids()))
+	async1.Publish(`[5,[[9001,1,1],[9011,1,-1]]]`)
+	migrated, err := nextOf[*websocket.SubscriptionMigrated](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SubscriptionMigrated{OldSubID: btcId, NewSubID: req.SubID, From: 0, To: 1}, migrated)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 1, len(ob.Bids()))
+	assert(t, 9001.0, ob.Bids()[0].Price)
+
+	// the old subscription is dropped after the switch
+	if err := async.waitForMessage(pre); err != nil {
+		t.Fatal(err)
+	}
+	unsub, err := json.Marshal(async.sentAt(pre))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unsubscribe","chanId":5}`, string(unsub))
+	async.Publish(`[5,[8980,1,2]]`)
+	async.Publish(`{"event":"unsubscribed","status":"OK","chanId":5}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+	async1.Publish(`[5,[9002,1,1]]`)
+	async1.Publish(`[5,"hb"]`)
+	assert(t, 2, len(ob.Bids()))
+	assert(t, 9002.0, ob.Bids()[0].Price)
+
+	h := ws.Health()
+	assert(t, 2, h.Sockets[0].Subscriptions)
+	assert(t, 1, h.Sockets[1].Subscriptions)
+
+	// a balanced client stays untouched
+	pre1 := async1.SentCount()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ws.Rebalance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, pre1, async1.SentCount())
+}
+
+func TestSymbolHashSubscribe(t *testing.T) {
+	// create transport & nonce mocks
+	pool := &TestAsyncPool{}
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.PingInterval = 0
+	p.ShardingPolicy = websocket.SymbolHash{Shards: 3}
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, pool, nonce)
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	// tSOLUSD hashes onto the third shard, connections are opened up to it
+	tickerId, err := ws.SubscribeTicker(context.Background(), "tSOLUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 3, ws.ConnectionCount())
+	assert(t, tickerId, waitForRequest(t, pool.get(2), 0).SubID)
+
+	// all subscriptions of the symbol share the connection
+	tradesId, err := ws.SubscribeTrades(context.Background(), "tSOLUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 3, ws.ConnectionCount())
+	assert(t, tradesId, waitForRequest(t, pool.get(2), 1).SubID)
+	for i := 0; i < 2; i++ {
+		assert(t, 0, pool.get(i).SentCount())
+	}
+}
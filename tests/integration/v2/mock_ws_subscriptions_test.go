@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/v2/websocket"
+)
+
+func TestSubscriptionManagement(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	ws := websocket.NewWithAsyncFactoryNonce(newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, symbol := range []string{"tBTCUSD", "tETHUSD", "tXRPUSD"} {
+		if _, err := ws.SubscribeTicker(ctx, symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ws.SubscribeTrades(ctx, "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+
+	// activate the tickers
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":6,"symbol":"tETHUSD","subId":"nonce2","pair":"ETHUSD"}`)
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":7,"symbol":"tXRPUSD","subId":"nonce3","pair":"XRPUSD"}`)
+	act, err := nextOf[*websocket.SubscriptionActivated](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SubscriptionActivated{
+		SubID:   "nonce1",
+		ChanID:  5,
+		Request: &websocket.SubscriptionRequest{SubID: "nonce1", Event: "subscribe", Channel: "ticker", Symbol: "tBTCUSD"},
+	}, act)
+	for i := 0; i < 2; i++ {
+		if _, err := nextOf[*websocket.SubscriptionActivated](listener); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	async.Publish(`[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`)
+	if _, err := listener.nextTick(); err != nil {
+		t.Fatal(err)
+	}
+
+	subs := ws.Subscriptions()
+	assert(t, 4, len(subs))
+	assert(t, "nonce1", subs[0].SubID)
+	assert(t, int64(5), subs[0].ChanID)
+	assert(t, int64(1), subs[0].Messages)
+	if subs[0].Pending || subs[0].LastHeartbeat.IsZero() {
+		t.Fatalf("expected active subscription with heartbeat: %#v", subs[0])
+	}
+	assert(t, int64(0), subs[1].Messages)
+	assert(t, "nonce4", subs[3].SubID)
+	assert(t, true, subs[3].Pending)
+	assert(t, int64(-1), subs[3].ChanID)
+
+	// reject the trades subscription
+	async.Publish(`{"event":"error","msg":"subscribe: dup","code":10301,"subId":"nonce4","channel":"trades","symbol":"tBTCUSD"}`)
+	rej, err := nextOf[*websocket.SubscriptionRejected](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, &websocket.SubscriptionRejected{
+		SubID:   "nonce4",
+		Request: &websocket.SubscriptionRequest{SubID: "nonce4", Event: "subscribe", Channel: "trades", Symbol: "tBTCUSD"},
+		Code:    10301,
+		Message: "subscribe: dup",
+	}, rej)
+	assert(t, 3, len(ws.Subscriptions()))
+
+	// unsubscribe by symbol, then all
+	ids, err := ws.UnsubscribeBy(ctx, websocket.SubscriptionFilter{Symbol: "tETHUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 1, len(ids))
+	assert(t, "nonce2", ids[0])
+	if err := async.waitForMessage(4); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unsubscribe","chanId":6}`, marshal(t, async.sentAt(4)))
+	async.Publish(`{"event":"unsubscribed","chanId":6,"status":"OK"}`)
+	if _, err := listener.nextUnsubscriptionEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err = ws.UnsubscribeAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, 2, len(ids))
+	assert(t, "nonce1", ids[0])
+	assert(t, "nonce3", ids[1])
+	if err := async.waitForMessage(6); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, `{"event":"unsubscribe","chanId":5}`, marshal(t, async.sentAt(5)))
+	assert(t, `{"event":"unsubscribe","chanId":7}`, marshal(t, async.sentAt(6)))
+}
+
+func TestSubscriptionDropped(t *testing.T) {
+	// create transport & nonce mocks
+	async := newTestAsync()
+	nonce := &IncrementingNonceGenerator{}
+
+	// create client
+	p := websocket.NewDefaultParameters()
+	p.HeartbeatTimeout = time.Millisecond * 100
+	p.AutoReconnect = false
+	ws := websocket.NewWithParamsAsyncFactoryNonce(p, newTestAsyncFactory(async), nonce)
+
+	// setup listener
+	listener := newListener()
+	listener.run(ws.Listen())
+
+	// set ws options
+	err_ws := ws.Connect()
+	if err_ws != nil {
+		t.Fatal(err_ws)
+	}
+	defer ws.Close()
+
+	async.Publish(`{"event":"info","version":2}`)
+	if _, err := listener.nextInfoEvent(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.SubscribeTicker(context.Background(), "tBTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	async.Publish(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"tBTCUSD","subId":"nonce1","pair":"BTCUSD"}`)
+
+	// no heartbeats follow
+	drop, err := nextOf[*websocket.SubscriptionDropped](listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "nonce1", drop.SubID)
+	assert(t, int64(5), drop.ChanID)
+	if drop.Error == nil {
+		t.Fatal("expected heartbeat error")
+	}
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
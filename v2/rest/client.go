@@ -10,7 +10,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
 	"github.com/vx416/bitfinex-api-go/pkg/models/common"
 	"github.com/vx416/bitfinex-api-go/pkg/utils"
 )
@@ -32,6 +38,8 @@ type Client struct {
 	apiKey    string
 	apiSecret string
 	nonce     utils.NonceGenerator
+	log       logger.Logger
+	metrics   metrics.Sink
 
 	// service providers
 	Candles        CandleService
@@ -108,6 +116,8 @@ func NewClientWithSynchronousURLNonce(sync Synchronous, url string, nonce utils.
 	c := &Client{
 		Synchronous: sync,
 		nonce:       nonce,
+		log:         logger.Nop(),
+		metrics:     metrics.Nop(),
 	}
 	c.Orders = OrderService{Synchronous: c, requestFactory: c}
 	c.Book = BookService{Synchronous: c}
@@ -137,6 +147,66 @@ func (c *Client) Credentials(key string, secret string) *Client {
 	return c
 }
 
+// Set the logger used for requests and errors, credentials are redacted
+func (c *Client) WithLogger(log logger.Logger) *Client {
+	c.log = log
+	return c
+}
+
+// Set the sink receiving request counts and latencies per endpoint
+func (c *Client) WithMetrics(sink metrics.Sink) *Client {
+	c.metrics = sink
+	return c
+}
+
+// Request sends the request with the synchronous handler, logging it along
+// with errors returned by the API and recording its latency
+func (c *Client) Request(req Request) ([]interface{}, error) {
+	c.log.Debugf("%s %s headers=%v", req.Method, req.RefURL, logger.RedactHeaders(req.Headers))
+	start := time.Now()
+	raw, err := c.Synchronous.Request(req)
+	endpoint, symbol := endpointLabels(req.RefURL)
+	c.metrics.Observe(metrics.RestLatency, metrics.Labels{"endpoint": endpoint, "method": req.Method}, time.Since(start).Seconds())
+	c.metrics.IncCounter(metrics.RestRequests, metrics.Labels{
+		"endpoint": endpoint,
+		"method":   req.Method,
+		"symbol":   symbol,
+		"status":   requestStatus(err),
+	}, 1)
+	if err != nil {
+		c.log.Warningf("%s %s failed: %s", req.Method, req.RefURL, err.Error())
+	}
+	return raw, err
+}
+
+var symbolPattern = regexp.MustCompile(`^[tf][A-Z0-9]{3,}(:[A-Z0-9]+)?$`)
+
+// endpointLabels replaces the symbol in a request url by a placeholder, so
+// requests of all symbols are recorded for the same endpoint
+func endpointLabels(refURL string) (string, string) {
+	path := strings.SplitN(refURL, "?", 2)[0]
+	segments := strings.Split(path, "/")
+	symbol := ""
+	for i, s := range segments {
+		if symbolPattern.MatchString(s) {
+			symbol = s
+			segments[i] = ":symbol"
+		}
+	}
+	return strings.Join(segments, "/"), symbol
+}
+
+// requestStatus is the http status code of a failed request, "ok" on success
+func requestStatus(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if er, ok := err.(*ErrorResponse); ok && er.Response != nil && er.Response.Response != nil {
+		return strconv.Itoa(er.Response.Response.StatusCode)
+	}
+	return "error"
+}
+
 // Request is a wrapper for standard http.Request.  Default method is POST with no data.
 type Request struct {
 	RefURL  string     // ref url
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "tETHUSD") {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, err := w.Write([]byte(`["error",10020,"symbol: invalid"]`))
+			require.Nil(t, err)
+			return
+		}
+		_, err := w.Write([]byte(`[1]`))
+		require.Nil(t, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	reg := metrics.NewRegistry()
+	c := NewClientWithURL(server.URL).WithMetrics(reg)
+	_, err := c.Request(NewRequestWithMethod("ticker/tBTCUSD", "GET"))
+	require.Nil(t, err)
+	_, err = c.Request(NewRequestWithMethod("ticker/tETHUSD", "GET"))
+	require.NotNil(t, err)
+
+	w := httptest.NewRecorder()
+	require.Nil(t, reg.Write(w))
+	out := w.Body.String()
+	assert.Contains(t, out, `bfx_rest_requests_total{endpoint="ticker/:symbol",method="GET",status="ok",symbol="tBTCUSD"} 1`)
+	assert.Contains(t, out, `bfx_rest_requests_total{endpoint="ticker/:symbol",method="GET",status="500",symbol="tETHUSD"} 1`)
+	assert.Contains(t, out, `bfx_rest_request_duration_seconds_count{endpoint="ticker/:symbol",method="GET"} 2`)
+}
+
+func TestEndpointLabels(t *testing.T) {
+	endpoint, symbol := endpointLabels("auth/r/orders/tBTCF0:USTF0/hist")
+	assert.Equal(t, "auth/r/orders/:symbol/hist", endpoint)
+	assert.Equal(t, "tBTCF0:USTF0", symbol)
+
+	endpoint, symbol = endpointLabels("auth/r/wallets")
+	assert.Equal(t, "auth/r/wallets", endpoint)
+	assert.Equal(t, "", symbol)
+}
@@ -67,11 +67,19 @@ func (c *Client) AvailableCapacity() int {
 // Start a new websocket connection. This function is only exposed in case you want to
 // implicitly add new connections otherwise connection management is already handled for you.
 func (c *Client) StartNewConnection() error {
-	return c.connectSocket(SocketId(c.ConnectionCount()))
+	_, err := c.startConnection()
+	return err
+}
+
+// startConnection opens a new websocket connection and returns its socket id
+func (c *Client) startConnection() (SocketId, error) {
+	socketId := SocketId(c.ConnectionCount())
+	return socketId, c.connectSocket(socketId)
 }
 
 func (c *Client) subscribeBySocket(ctx context.Context, socket *Socket, req *SubscriptionRequest) (string, error) {
 	c.subscriptions.add(socket.Id, req)
+	c.recordSubscriptions(socket.Id)
 	err := socket.Asynchronous.Send(ctx, req)
 	if err != nil {
 		// propagate send error
@@ -82,14 +90,8 @@ func (c *Client) subscribeBySocket(ctx context.Context, socket *Socket, req *Sub
 
 // Submit a request to subscribe to the given SubscriptionRequuest
 func (c *Client) Subscribe(ctx context.Context, req *SubscriptionRequest) (string, error) {
-	if c.getTotalAvailableSocketCapacity() <= 1 {
-		err := c.StartNewConnection()
-		if err != nil {
-			return "", err
-		}
-	}
-	// get socket with the highest available capacity
-	socket, err := c.getMostAvailableSocket()
+	// get socket assigned by the sharding policy
+	socket, err := c.selectSocket(req)
 	if err != nil {
 		return "", err
 	}
@@ -160,6 +162,14 @@ func (c *Client) SubscribeStatus(ctx context.Context, symbol string, sType commo
 	return c.Subscribe(ctx, req)
 }
 
+// SubscribeLiquidations subscribes to the global liquidation feed. The first
+// message is a status.LiquidationsSnapshot of recent liquidations, followed by
+// a status.Liquidation for every new one, or a status.LiquidationsUpdate when
+// several arrive in the same frame.
+func (c *Client) SubscribeLiquidations(ctx context.Context) (string, error) {
+	return c.SubscribeStatus(ctx, "global", common.StatusType("liq"))
+}
+
 // Retrieve the Orderbook for the given symbol which is managed locally.
 // This requires ManageOrderbook=True and an active chanel subscribed to the given
 // symbols orderbook
@@ -173,8 +183,49 @@ func (c *Client) GetOrderbook(symbol string) (*Orderbook, error) {
 	return nil, fmt.Errorf("Orderbook %s does not exist", symbol)
 }
 
+// Retrieve the raw (R0) Orderbook for the given symbol which is managed locally.
+// This requires ManageOrderbook=True and an active channel subscribed to the given
+// symbols raw book
+func (c *Client) GetRawOrderbook(symbol string) (*RawOrderbook, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if val, ok := c.rawOrderbooks[symbol]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("Raw orderbook %s does not exist", symbol)
+}
+
+// Retrieve the funding Orderbook for the given symbol which is managed locally.
+// This requires ManageOrderbook=True and an active channel subscribed to the given
+// funding symbols aggregated book
+func (c *Client) GetFundingOrderbook(symbol string) (*FundingOrderbook, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if val, ok := c.fundingBooks[symbol]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("Funding orderbook %s does not exist", symbol)
+}
+
+// Retrieve the locally tracked position for the given symbol, marked to market
+// with the latest price. This requires ManagePositions=True and an authenticated connection.
+func (c *Client) GetTrackedPosition(symbol string) (*TrackedPosition, error) {
+	if p, ok := c.positions.Position(symbol); ok {
+		return &p, nil
+	}
+	return nil, fmt.Errorf("Position %s is not tracked", symbol)
+}
+
+// Retrieve all locally tracked positions. This requires ManagePositions=True.
+func (c *Client) TrackedPositions() []TrackedPosition {
+	return c.positions.Positions()
+}
+
 // Submit a request to create a new order
 func (c *Client) SubmitOrder(ctx context.Context, onr *order.NewRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -184,6 +235,9 @@ func (c *Client) SubmitOrder(ctx context.Context, onr *order.NewRequest) error {
 
 // Submit and update request to change an existing orders values
 func (c *Client) SubmitUpdateOrder(ctx context.Context, our *order.UpdateRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -193,6 +247,9 @@ func (c *Client) SubmitUpdateOrder(ctx context.Context, our *order.UpdateRequest
 
 // Submit a cancel request for an existing order
 func (c *Client) SubmitCancel(ctx context.Context, ocr *order.CancelRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -211,6 +268,9 @@ func (c *Client) LookupSubscription(subID string) (*SubscriptionRequest, error)
 
 // Submit a new funding offer request
 func (c *Client) SubmitFundingOffer(ctx context.Context, fundingOffer *fundingoffer.SubmitRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -220,6 +280,9 @@ func (c *Client) SubmitFundingOffer(ctx context.Context, fundingOffer *fundingof
 
 // Submit a request to cancel and existing funding offer
 func (c *Client) SubmitFundingCancel(ctx context.Context, fundingOffer *fundingoffer.CancelRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -229,6 +292,9 @@ func (c *Client) SubmitFundingCancel(ctx context.Context, fundingOffer *fundingo
 
 // CloseFundingLoan - cancels funding loan by ID. Emits an error if not authenticated.
 func (c *Client) CloseFundingLoan(ctx context.Context, flcr *fundingloan.CancelRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
@@ -238,6 +304,9 @@ func (c *Client) CloseFundingLoan(ctx context.Context, flcr *fundingloan.CancelR
 
 // CloseFundingCredit - cancels funding credit by ID. Emits an error if not authenticated.
 func (c *Client) CloseFundingCredit(ctx context.Context, fundingOffer *fundingcredit.CancelRequest) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
 	socket, err := c.GetAuthenticatedSocket()
 	if err != nil {
 		return err
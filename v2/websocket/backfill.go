@@ -0,0 +1,330 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/candle"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
+)
+
+// maximum number of REST pages fetched to fill a single gap
+const backfillMaxPages = 10
+const backfillPageLimit = 1000
+
+// TradeHistory provides the public trades used to backfill trade subscriptions,
+// it is implemented by rest.TradeService.
+type TradeHistory interface {
+	PublicHistoryWithQuery(symbol string, start common.Mts, end common.Mts, limit common.QueryLimit, sort common.SortOrder) (*trade.Snapshot, error)
+}
+
+// BackfilledTrade is a public trade missed while disconnected, fetched over REST
+// after resubscribing and published before the new trades snapshot.
+type BackfilledTrade struct {
+	trade.Trade
+}
+
+// BackfilledCandle is a candle missed while disconnected, fetched over REST
+// after resubscribing and published before the new candles snapshot. The
+// candle that was in progress when the connection dropped is published again
+// with its final values.
+type BackfilledCandle struct {
+	candle.Candle
+}
+
+// backfillMark is the last item seen on a trades or candles subscription
+type backfillMark struct {
+	mts     int64
+	id      int64
+	pending bool          // resubscribed after a reconnect, waiting for the first message
+	running bool          // backfill in progress, live messages are held back
+	held    []heldMessage // live messages delivered once the backfill completed
+}
+
+// heldMessage is a live message waiting for the backfill of its subscription
+type heldMessage struct {
+	msg     interface{}
+	deliver func(interface{})
+}
+
+type backfiller struct {
+	lock    sync.Mutex
+	trades  TradeHistory
+	candles CandleHistory
+	marks   map[string]*backfillMark
+}
+
+// WithBackfill enables backfilling trade and candle subscriptions after a
+// reconnect, using the given REST services to fetch the missed window. Either
+// service may be nil to only backfill the other channel.
+func (c *Client) WithBackfill(trades TradeHistory, candles CandleHistory) *Client {
+	c.backfill = &backfiller{trades: trades, candles: candles, marks: make(map[string]*backfillMark)}
+	return c
+}
+
+func backfillKey(req *SubscriptionRequest) string {
+	switch req.Channel {
+	case ChanTrades:
+		return ChanTrades + ":" + req.Symbol
+	case ChanCandles:
+		return ChanCandles + ":" + req.Key
+	}
+	return ""
+}
+
+// track records the newest trade or candle delivered on a subscription
+func (b *backfiller) track(key string, msg interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trackLocked(key, msg)
+}
+
+func (b *backfiller) trackLocked(key string, msg interface{}) {
+	mark, ok := b.marks[key]
+	if !ok {
+		mark = &backfillMark{}
+		b.marks[key] = mark
+	}
+	switch m := msg.(type) {
+	case *trade.Trade:
+		mark.advance(m.MTS, m.ID)
+	case *trade.Snapshot:
+		for _, t := range m.Snapshot {
+			mark.advance(t.MTS, t.ID)
+		}
+	case *candle.Candle:
+		mark.advance(m.MTS, 0)
+	case *candle.Snapshot:
+		for _, cn := range m.Snapshot {
+			mark.advance(cn.MTS, 0)
+		}
+	}
+}
+
+func (m *backfillMark) advance(mts, id int64) {
+	if mts > m.mts || (mts == m.mts && id > m.id) {
+		m.mts, m.id = mts, id
+	}
+}
+
+// expect marks resubscribed channels so their gap is filled on the first message
+func (b *backfiller) expect(req *SubscriptionRequest) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if mark, ok := b.marks[backfillKey(req)]; ok && mark.mts > 0 {
+		mark.pending = true
+	}
+}
+
+// hold queues the delivery of a live message while a backfill of the key is
+// running, it is tracked once released
+func (b *backfiller) hold(key string, msg interface{}, deliver func(interface{})) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	mark, ok := b.marks[key]
+	if !ok || !mark.running {
+		return false
+	}
+	mark.held = append(mark.held, heldMessage{msg: msg, deliver: deliver})
+	return true
+}
+
+// take returns the last item seen before a reconnect if the gap is still to be
+// filled and holds back live messages until the backfill completed
+func (b *backfiller) take(key string) (backfillMark, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	mark, ok := b.marks[key]
+	if !ok || !mark.pending {
+		return backfillMark{}, false
+	}
+	gap := *mark
+	mark.pending = false
+	mark.running = true
+	return gap, true
+}
+
+// release returns the live messages held back during the backfill, the backfill
+// ends once no messages are left
+func (b *backfiller) release(key string) []heldMessage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	mark := b.marks[key]
+	held := mark.held
+	mark.held = nil
+	if len(held) == 0 {
+		mark.running = false
+	}
+	return held
+}
+
+// unseen removes the items of a trades or candles message delivered before the
+// reconnect, up to the given mark. The candle in progress at the mark is kept
+// with its final values. It reports false if no item is left.
+func unseen(msg interface{}, mark backfillMark) (interface{}, bool) {
+	seenTrade := func(t *trade.Trade) bool {
+		return t.MTS < mark.mts || (t.MTS == mark.mts && t.ID <= mark.id)
+	}
+	switch m := msg.(type) {
+	case *trade.Trade:
+		return m, !seenTrade(m)
+	case *trade.Snapshot:
+		trades := make([]*trade.Trade, 0, len(m.Snapshot))
+		for _, t := range m.Snapshot {
+			if !seenTrade(t) {
+				trades = append(trades, t)
+			}
+		}
+		return &trade.Snapshot{Snapshot: trades}, len(trades) > 0
+	case *candle.Candle:
+		return m, m.MTS >= mark.mts
+	case *candle.Snapshot:
+		candles := make([]*candle.Candle, 0, len(m.Snapshot))
+		for _, cn := range m.Snapshot {
+			if cn.MTS >= mark.mts {
+				candles = append(candles, cn)
+			}
+		}
+		return &candle.Snapshot{Snapshot: candles}, len(candles) > 0
+	}
+	return msg, true
+}
+
+// oldestMTS returns the time of the oldest item in a trades or candles message
+func oldestMTS(msg interface{}) int64 {
+	var oldest int64
+	visit := func(mts int64) {
+		if oldest == 0 || mts < oldest {
+			oldest = mts
+		}
+	}
+	switch m := msg.(type) {
+	case *trade.Trade:
+		visit(m.MTS)
+	case *trade.Snapshot:
+		for _, t := range m.Snapshot {
+			visit(t.MTS)
+		}
+	case *candle.Candle:
+		visit(m.MTS)
+	case *candle.Snapshot:
+		for _, cn := range m.Snapshot {
+			visit(cn.MTS)
+		}
+	}
+	return oldest
+}
+
+// publishBackfill delivers a trades or candles message. The first message after
+// a reconnect starts filling the gap to the last item seen before in the
+// background, live messages of the subscription are held back until the missed
+// items are published. Items of the first message seen before the reconnect
+// are not delivered again.
+func (c *Client) publishBackfill(sub *subscription, msg interface{}, deliver func(interface{})) {
+	if c.backfill == nil {
+		deliver(msg)
+		return
+	}
+	key := backfillKey(sub.Request)
+	if key == "" {
+		deliver(msg)
+		return
+	}
+	if c.backfill.hold(key, msg, deliver) {
+		return
+	}
+	mark, ok := c.backfill.take(key)
+	if !ok {
+		c.backfill.track(key, msg)
+		deliver(msg)
+		return
+	}
+	if fresh, ok := unseen(msg, mark); ok {
+		c.backfill.hold(key, fresh, deliver)
+	}
+	c.spawn(func() {
+		if until := oldestMTS(msg); until > mark.mts {
+			var err error
+			switch sub.Request.Channel {
+			case ChanTrades:
+				err = c.backfillTrades(sub.Request.Symbol, mark, until)
+			case ChanCandles:
+				err = c.backfillCandles(sub.Request.Key, mark, until)
+			}
+			if err != nil {
+				c.subLog(sub).Warningf("could not backfill %s: %s", sub.Request.String(), err.Error())
+			}
+		}
+		for held := c.backfill.release(key); len(held) > 0; held = c.backfill.release(key) {
+			for _, h := range held {
+				c.backfill.track(key, h.msg)
+				h.deliver(h.msg)
+			}
+		}
+	})
+}
+
+// backfillTrades publishes the trades after mark and before until, oldest first
+func (c *Client) backfillTrades(symbol string, mark backfillMark, until int64) error {
+	if c.backfill.trades == nil {
+		return nil
+	}
+	start := mark.mts
+	for page := 0; page < backfillMaxPages; page++ {
+		snap, err := c.backfill.trades.PublicHistoryWithQuery(symbol, common.Mts(start), common.Mts(until-1), backfillPageLimit, common.OldestFirst)
+		if err != nil {
+			return err
+		}
+		if snap == nil || len(snap.Snapshot) == 0 {
+			return nil
+		}
+		for _, t := range snap.Snapshot {
+			if t.MTS < mark.mts || (t.MTS == mark.mts && t.ID <= mark.id) {
+				continue
+			}
+			mark.mts, mark.id = t.MTS, t.ID
+			c.publish(&BackfilledTrade{Trade: *t})
+		}
+		if len(snap.Snapshot) < backfillPageLimit {
+			return nil
+		}
+		start = mark.mts
+	}
+	c.log.Warningf("trades backfill for %s truncated at %d", symbol, mark.mts)
+	return nil
+}
+
+// backfillCandles publishes the candles from mark and before until, oldest first
+func (c *Client) backfillCandles(key string, mark backfillMark, until int64) error {
+	if c.backfill.candles == nil {
+		return nil
+	}
+	symbol, resolution, err := extractSymbolResolutionFromKey(key)
+	if err != nil {
+		return err
+	}
+	start := mark.mts
+	last := int64(-1)
+	for page := 0; page < backfillMaxPages; page++ {
+		snap, err := c.backfill.candles.HistoryWithQuery(symbol, resolution, common.Mts(start), common.Mts(until-1), backfillPageLimit, common.OldestFirst)
+		if err != nil {
+			return err
+		}
+		if snap == nil || len(snap.Snapshot) == 0 {
+			return nil
+		}
+		for _, cn := range snap.Snapshot {
+			if cn.MTS < mark.mts || cn.MTS <= last {
+				continue
+			}
+			last = cn.MTS
+			c.publish(&BackfilledCandle{Candle: *cn})
+		}
+		if len(snap.Snapshot) < backfillPageLimit {
+			return nil
+		}
+		start = last + 1
+	}
+	c.log.Warningf("candles backfill for %s truncated at %d", key, last)
+	return nil
+}
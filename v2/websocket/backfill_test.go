@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
+)
+
+type testTradeHistory struct {
+	trades  []*trade.Trade
+	start   common.Mts
+	end     common.Mts
+	release chan struct{} // blocks the query until closed if set
+}
+
+func (h *testTradeHistory) PublicHistoryWithQuery(symbol string, start common.Mts, end common.Mts, limit common.QueryLimit, sort common.SortOrder) (*trade.Snapshot, error) {
+	if h.release != nil {
+		<-h.release
+	}
+	h.start, h.end = start, end
+	return &trade.Snapshot{Snapshot: h.trades}, nil
+}
+
+func newBackfillTestClient(history TradeHistory) *Client {
+	c := &Client{
+		listener: make(chan interface{}, 10),
+		log:      logger.NewGoLogging(logging.MustGetLogger("test")),
+		mtx:      &sync.RWMutex{},
+		shutdown: make(chan struct{}),
+	}
+	return c.WithBackfill(history, nil)
+}
+
+// deliverTo publishes the message itself as the live delivery
+func deliverTo(c *Client) func(interface{}) {
+	return func(msg interface{}) { c.publish(msg) }
+}
+
+func TestBackfillTradesAfterReconnect(t *testing.T) {
+	history := &testTradeHistory{trades: []*trade.Trade{
+		testTrade(2, 2000, 100, 1), // already seen
+		testTrade(3, 2000, 101, 1),
+		testTrade(4, 3000, 102, 1),
+	}}
+	c := newBackfillTestClient(history)
+	req := &SubscriptionRequest{Channel: ChanTrades, Symbol: "tBTCUSD"}
+	sub := &subscription{Request: req}
+
+	first := &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(2, 2000, 100, 1), testTrade(1, 1000, 99, 1)}}
+	c.publishBackfill(sub, first, deliverTo(c))
+	assert.Equal(t, first, <-c.listener)
+
+	// resubscribed after a reconnect, the new snapshot starts after the gap
+	c.backfill.expect(req)
+	snap := &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(6, 5000, 104, 1), testTrade(5, 4000, 103, 1)}}
+	c.publishBackfill(sub, snap, deliverTo(c))
+	c.waitGroup.Wait()
+	assert.Equal(t, common.Mts(2000), history.start)
+	assert.Equal(t, common.Mts(3999), history.end)
+	assert.Len(t, c.listener, 3)
+	assert.Equal(t, &BackfilledTrade{Trade: *testTrade(3, 2000, 101, 1)}, <-c.listener)
+	assert.Equal(t, &BackfilledTrade{Trade: *testTrade(4, 3000, 102, 1)}, <-c.listener)
+	assert.Equal(t, snap, <-c.listener)
+
+	// only backfilled once per reconnect
+	history.start = 0
+	live := testTrade(7, 6000, 105, 1)
+	c.publishBackfill(sub, live, deliverTo(c))
+	assert.Equal(t, common.Mts(0), history.start)
+	assert.Equal(t, live, <-c.listener)
+}
+
+func TestBackfillHoldsLiveMessages(t *testing.T) {
+	history := &testTradeHistory{
+		trades:  []*trade.Trade{testTrade(3, 2000, 101, 1)},
+		release: make(chan struct{}),
+	}
+	c := newBackfillTestClient(history)
+	req := &SubscriptionRequest{Channel: ChanTrades, Symbol: "tBTCUSD"}
+	sub := &subscription{Request: req}
+	first := testTrade(2, 2000, 100, 1)
+	c.publishBackfill(sub, first, deliverTo(c))
+	<-c.listener
+
+	c.backfill.expect(req)
+	snap := &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(5, 4000, 103, 1)}}
+	c.publishBackfill(sub, snap, deliverTo(c))
+
+	// the backfill does not block the caller, live messages wait for it
+	live := testTrade(6, 5000, 104, 1)
+	c.publishBackfill(sub, live, deliverTo(c))
+	assert.Empty(t, c.listener)
+
+	close(history.release)
+	c.waitGroup.Wait()
+	assert.Equal(t, &BackfilledTrade{Trade: *testTrade(3, 2000, 101, 1)}, <-c.listener)
+	assert.Equal(t, snap, <-c.listener)
+	assert.Equal(t, live, <-c.listener)
+	// released messages advance the mark
+	assert.Equal(t, int64(5000), c.backfill.marks[backfillKey(req)].mts)
+	assert.Equal(t, int64(6), c.backfill.marks[backfillKey(req)].id)
+
+	// delivered directly once the held messages are flushed
+	next := testTrade(7, 6000, 105, 1)
+	c.publishBackfill(sub, next, deliverTo(c))
+	assert.Equal(t, next, <-c.listener)
+}
+
+func TestBackfillDropsSeenSnapshotItems(t *testing.T) {
+	history := &testTradeHistory{}
+	c := newBackfillTestClient(history)
+	req := &SubscriptionRequest{Channel: ChanTrades, Symbol: "tBTCUSD"}
+	sub := &subscription{Request: req}
+
+	first := &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(2, 2000, 100, 1), testTrade(1, 1000, 99, 1)}}
+	c.publishBackfill(sub, first, deliverTo(c))
+	assert.Equal(t, first, <-c.listener)
+
+	// the new snapshot overlaps the trades seen before the reconnect
+	c.backfill.expect(req)
+	snap := &trade.Snapshot{Snapshot: []*trade.Trade{
+		testTrade(4, 3000, 102, 1),
+		testTrade(3, 2000, 101, 1),
+		testTrade(2, 2000, 100, 1),
+		testTrade(1, 1000, 99, 1),
+	}}
+	c.publishBackfill(sub, snap, deliverTo(c))
+	c.waitGroup.Wait()
+	assert.Equal(t, common.Mts(0), history.start, "no gap to fill")
+	assert.Len(t, c.listener, 1)
+	assert.Equal(t, &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(4, 3000, 102, 1), testTrade(3, 2000, 101, 1)}}, <-c.listener)
+
+	// a snapshot of seen trades only is not delivered
+	c.backfill.expect(req)
+	c.publishBackfill(sub, &trade.Snapshot{Snapshot: []*trade.Trade{testTrade(4, 3000, 102, 1)}}, deliverTo(c))
+	c.waitGroup.Wait()
+	assert.Empty(t, c.listener)
+	live := testTrade(5, 4000, 103, 1)
+	c.publishBackfill(sub, live, deliverTo(c))
+	assert.Equal(t, live, <-c.listener)
+}
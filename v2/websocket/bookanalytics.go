@@ -0,0 +1,281 @@
+package websocket
+
+import (
+	"fmt"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// order book analytics errors
+var (
+	ErrBookSideEmpty     = fmt.Errorf("order book side is empty")
+	ErrInsufficientDepth = fmt.Errorf("insufficient order book depth to fill size")
+)
+
+// BookView is an immutable view of the top of an Orderbook taken under a single
+// lock, so that several analytics can be calculated against the same state.
+// Levels are never modified by the Orderbook once inserted, so the view only
+// holds references to them.
+//
+// Methods taking a side refer to the side of the book that is consumed: use
+// common.Ask to analyse a buy (lifting the offers) and common.Bid for a sell.
+type BookView struct {
+	symbol string
+	bids   bookLevels
+	asks   bookLevels
+}
+
+// bookLevels are the levels of a book side, best price first
+type bookLevels interface {
+	best() (*book.Book, bool)
+	eachLevel(n int, fn func(*book.Book) bool)
+}
+
+// levelSlice holds the levels of a side copied into a view
+type levelSlice []*book.Book
+
+func (s levelSlice) best() (*book.Book, bool) {
+	if len(s) == 0 {
+		return nil, false
+	}
+	return s[0], true
+}
+
+func (s levelSlice) eachLevel(n int, fn func(*book.Book) bool) {
+	if n <= 0 || n > len(s) {
+		n = len(s)
+	}
+	for _, l := range s[:n] {
+		if !fn(l) {
+			return
+		}
+	}
+}
+
+// View takes a consistent view of the n best levels per side of the book, or
+// the whole book if n <= 0.
+func (ob *Orderbook) View(n int) *BookView {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return &BookView{
+		symbol: ob.symbol,
+		bids:   levelSlice(ob.bids.top(n)),
+		asks:   levelSlice(ob.asks.top(n)),
+	}
+}
+
+// view wraps the live levels of the book, callers must hold the read lock.
+func (ob *Orderbook) view() *BookView {
+	return &BookView{symbol: ob.symbol, bids: ob.bids, asks: ob.asks}
+}
+
+// levelCopies returns dereferenced copies of all levels
+func levelCopies(levels bookLevels) []book.Book {
+	cpy := make([]book.Book, 0)
+	levels.eachLevel(0, func(b *book.Book) bool {
+		cpy = append(cpy, *b)
+		return true
+	})
+	return cpy
+}
+
+func (v *BookView) Symbol() string {
+	return v.symbol
+}
+
+// Bids returns a dereferenced copy of the bid levels in the view.
+func (v *BookView) Bids() []book.Book {
+	return levelCopies(v.bids)
+}
+
+// Asks returns a dereferenced copy of the ask levels in the view.
+func (v *BookView) Asks() []book.Book {
+	return levelCopies(v.asks)
+}
+
+func (v *BookView) side(side common.OrderSide) bookLevels {
+	if side == common.Bid {
+		return v.bids
+	}
+	return v.asks
+}
+
+// Mid returns the price half way between the best bid and the best ask.
+func (v *BookView) Mid() (float64, error) {
+	bid, hasBid := v.bids.best()
+	ask, hasAsk := v.asks.best()
+	if !hasBid || !hasAsk {
+		return 0, ErrBookSideEmpty
+	}
+	return (bid.Price + ask.Price) / 2, nil
+}
+
+// Spread returns the difference between the best ask and the best bid.
+func (v *BookView) Spread() (float64, error) {
+	bid, hasBid := v.bids.best()
+	ask, hasAsk := v.asks.best()
+	if !hasBid || !hasAsk {
+		return 0, ErrBookSideEmpty
+	}
+	return ask.Price - bid.Price, nil
+}
+
+// Depth returns the cumulative amount of the n best levels on the given side,
+// or of the whole side if n <= 0.
+func (v *BookView) Depth(side common.OrderSide, n int) float64 {
+	depth := 0.0
+	v.side(side).eachLevel(n, func(l *book.Book) bool {
+		depth += l.Amount
+		return true
+	})
+	return depth
+}
+
+// DepthToPrice returns the cumulative amount on the given side at prices equal
+// to or better than the given price.
+func (v *BookView) DepthToPrice(side common.OrderSide, price float64) float64 {
+	depth := 0.0
+	v.side(side).eachLevel(0, func(l *book.Book) bool {
+		if (side == common.Bid && l.Price < price) || (side != common.Bid && l.Price > price) {
+			return false
+		}
+		depth += l.Amount
+		return true
+	})
+	return depth
+}
+
+// fill walks the given side until size is filled, returning the notional
+// value and the price of the last level consumed.
+func (v *BookView) fill(side common.OrderSide, size float64) (notional, last float64, err error) {
+	levels := v.side(side)
+	if _, ok := levels.best(); !ok {
+		return 0, 0, ErrBookSideEmpty
+	}
+	remaining := size
+	levels.eachLevel(0, func(l *book.Book) bool {
+		take := l.Amount
+		if take > remaining {
+			take = remaining
+		}
+		notional += take * l.Price
+		last = l.Price
+		remaining -= take
+		return remaining > 0
+	})
+	if remaining > 0 {
+		return notional, last, ErrInsufficientDepth
+	}
+	return notional, last, nil
+}
+
+// VWAP returns the volume weighted average price of filling size against the
+// given side.
+func (v *BookView) VWAP(side common.OrderSide, size float64) (float64, error) {
+	if size <= 0 {
+		return 0, fmt.Errorf("size must be positive: %f", size)
+	}
+	notional, _, err := v.fill(side, size)
+	if err != nil {
+		return 0, err
+	}
+	return notional / size, nil
+}
+
+// Slippage returns the expected slippage of filling size against the given
+// side, as the fraction between the VWAP and the best price. A positive value
+// is always a worse price than the best level.
+func (v *BookView) Slippage(side common.OrderSide, size float64) (float64, error) {
+	vwap, err := v.VWAP(side, size)
+	if err != nil {
+		return 0, err
+	}
+	level, _ := v.side(side).best()
+	best := level.Price
+	if side == common.Bid {
+		return (best - vwap) / best, nil
+	}
+	return (vwap - best) / best, nil
+}
+
+// PriceToFill returns the worst price level reached when filling size against
+// the given side.
+func (v *BookView) PriceToFill(side common.OrderSide, size float64) (float64, error) {
+	if size <= 0 {
+		return 0, fmt.Errorf("size must be positive: %f", size)
+	}
+	_, last, err := v.fill(side, size)
+	if err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+// Imbalance returns the order book imbalance over the n best levels of each
+// side (all levels if n <= 0), ranging from -1 (asks only) to 1 (bids only).
+func (v *BookView) Imbalance(n int) float64 {
+	bids := v.Depth(common.Bid, n)
+	asks := v.Depth(common.Ask, n)
+	if bids+asks == 0 {
+		return 0
+	}
+	return (bids - asks) / (bids + asks)
+}
+
+// Mid returns the price half way between the best bid and the best ask.
+func (ob *Orderbook) Mid() (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().Mid()
+}
+
+// Spread returns the difference between the best ask and the best bid.
+func (ob *Orderbook) Spread() (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().Spread()
+}
+
+// Depth returns the cumulative amount of the n best levels on the given side.
+func (ob *Orderbook) Depth(side common.OrderSide, n int) float64 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().Depth(side, n)
+}
+
+// DepthToPrice returns the cumulative amount on the given side at prices equal
+// to or better than the given price.
+func (ob *Orderbook) DepthToPrice(side common.OrderSide, price float64) float64 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().DepthToPrice(side, price)
+}
+
+// VWAP returns the volume weighted average price of filling size against the given side.
+func (ob *Orderbook) VWAP(side common.OrderSide, size float64) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().VWAP(side, size)
+}
+
+// Slippage returns the expected slippage of filling size against the given side.
+func (ob *Orderbook) Slippage(side common.OrderSide, size float64) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().Slippage(side, size)
+}
+
+// PriceToFill returns the worst price level reached when filling size against the given side.
+func (ob *Orderbook) PriceToFill(side common.OrderSide, size float64) (float64, error) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().PriceToFill(side, size)
+}
+
+// Imbalance returns the order book imbalance over the n best levels of each side.
+func (ob *Orderbook) Imbalance(n int) float64 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.view().Imbalance(n)
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+func TestOrderbookAnalytics(t *testing.T) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testLevel(100, 1, 1),
+		testLevel(99, 1, 2),
+		testLevel(98, 1, 3),
+		testLevel(101, 1, -2),
+		testLevel(102, 1, -2),
+	}})
+
+	mid, err := ob.Mid()
+	assert.NoError(t, err)
+	assert.Equal(t, 100.5, mid)
+	spread, err := ob.Spread()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, spread)
+
+	assert.Equal(t, 3.0, ob.Depth(common.Bid, 2))
+	assert.Equal(t, 6.0, ob.Depth(common.Bid, 0))
+	assert.Equal(t, 3.0, ob.DepthToPrice(common.Bid, 99))
+	assert.Equal(t, 2.0, ob.DepthToPrice(common.Ask, 101.5))
+
+	// buy 3: 2 @ 101, 1 @ 102
+	vwap, err := ob.VWAP(common.Ask, 3)
+	assert.NoError(t, err)
+	assert.InDelta(t, 304.0/3, vwap, 1e-9)
+	slippage, err := ob.Slippage(common.Ask, 3)
+	assert.NoError(t, err)
+	assert.InDelta(t, (304.0/3-101)/101, slippage, 1e-9)
+	price, err := ob.PriceToFill(common.Ask, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 102.0, price)
+
+	// sell 2: 1 @ 100, 1 @ 99
+	slippage, err = ob.Slippage(common.Bid, 2)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.005, slippage, 1e-9)
+
+	_, err = ob.VWAP(common.Ask, 10)
+	assert.Equal(t, ErrInsufficientDepth, err)
+
+	assert.InDelta(t, (6.0-4.0)/10.0, ob.Imbalance(0), 1e-9)
+
+	// a view is not affected by later updates
+	view := ob.View(2)
+	ob.UpdateWith(testLevel(100, 0, 1))
+	mid, _ = view.Mid()
+	assert.Equal(t, 100.5, mid)
+	assert.Len(t, view.Bids(), 2)
+	mid, _ = ob.Mid()
+	assert.Equal(t, 100.0, mid)
+
+	empty := newOrderbook("tETHUSD")
+	_, err = empty.Mid()
+	assert.Equal(t, ErrBookSideEmpty, err)
+}
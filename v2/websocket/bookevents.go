@@ -0,0 +1,295 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// BookEventOptions configures the derived events emitted for a managed book
+// subscribed with SubscribeBookEvents.
+type BookEventOptions struct {
+	// TopN is the number of levels per side watched for level changes and
+	// included in snapshots, defaults to 10.
+	TopN int
+	// Throttle is the minimum interval between two batches of events for the
+	// symbol. Changes within the window are coalesced and published once the
+	// window has passed.
+	Throttle time.Duration
+	// SnapshotInterval publishes a BookTopSnapshot at most once per interval,
+	// zero disables snapshots.
+	SnapshotInterval time.Duration
+}
+
+// BookLevelChangeKind identifies whether a level entered or left the top N.
+type BookLevelChangeKind string
+
+const (
+	BookLevelAdded   BookLevelChangeKind = "added"
+	BookLevelRemoved BookLevelChangeKind = "removed"
+)
+
+// BookBestPriceChanged is published when the best level of one side of a
+// managed book changes price or amount. Empty is true when the side has no
+// levels left.
+type BookBestPriceChanged struct {
+	Symbol    string
+	Side      common.OrderSide
+	Price     float64
+	Amount    float64
+	PrevPrice float64
+	Empty     bool
+}
+
+// BookLevelChanged is published when a price level enters or leaves the top N
+// levels of one side. Rank is the zero based position of the level in the top N
+// it was added to or removed from.
+type BookLevelChanged struct {
+	Symbol string
+	Side   common.OrderSide
+	Kind   BookLevelChangeKind
+	Rank   int
+	Level  book.Book
+}
+
+// BookTopSnapshot is a periodic copy of the top N levels of both sides.
+type BookTopSnapshot struct {
+	Symbol string
+	Bids   []book.Book
+	Asks   []book.Book
+	Time   time.Time
+}
+
+type bookWatcher struct {
+	lock sync.Mutex
+
+	symbol       string
+	opts         BookEventOptions
+	bids         []book.Book // top levels as of the last published events
+	asks         []book.Book
+	lastEmit     time.Time
+	lastSnapshot time.Time
+	pending      bool
+
+	fire    func()      // flushes the watcher when its timer expires
+	timer   *time.Timer // armed for the next pending flush or snapshot
+	stopped bool
+}
+
+func newBookWatcher(symbol string, opts BookEventOptions) *bookWatcher {
+	if opts.TopN <= 0 {
+		opts.TopN = 10
+	}
+	return &bookWatcher{symbol: symbol, opts: opts}
+}
+
+// events diffs the top of the book against the last published state. Within the
+// throttle window the change is only marked as pending, flush only publishes
+// pending changes. A snapshot is added once the snapshot interval has passed.
+func (w *bookWatcher) events(ob *Orderbook, now time.Time, flush bool) []interface{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stopped {
+		return nil
+	}
+	defer w.schedule(now)
+
+	diff := !flush || w.pending
+	if diff && w.opts.Throttle > 0 && now.Sub(w.lastEmit) < w.opts.Throttle {
+		w.pending = true
+		diff = false
+	}
+	snapshot := w.opts.SnapshotInterval > 0 && now.Sub(w.lastSnapshot) >= w.opts.SnapshotInterval
+	if !diff && !snapshot {
+		return nil
+	}
+
+	view := ob.View(w.opts.TopN)
+	bids, asks := view.Bids(), view.Asks()
+	evs := make([]interface{}, 0)
+	if diff {
+		w.pending = false
+		evs = w.diffSide(evs, common.Bid, w.bids, bids)
+		evs = w.diffSide(evs, common.Ask, w.asks, asks)
+		w.bids, w.asks = bids, asks
+		if len(evs) > 0 {
+			w.lastEmit = now
+		}
+	}
+	if snapshot {
+		evs = append(evs, &BookTopSnapshot{Symbol: w.symbol, Bids: bids, Asks: asks, Time: now})
+		w.lastSnapshot = now
+	}
+	return evs
+}
+
+// schedule arms the timer for the next pending flush or snapshot, so they are
+// published on a quiet book as well. Callers must hold w.lock.
+func (w *bookWatcher) schedule(now time.Time) {
+	if w.fire == nil {
+		return
+	}
+	var due time.Time
+	if w.pending {
+		due = w.lastEmit.Add(w.opts.Throttle)
+	}
+	if w.opts.SnapshotInterval > 0 {
+		if next := w.lastSnapshot.Add(w.opts.SnapshotInterval); due.IsZero() || next.Before(due) {
+			due = next
+		}
+	}
+	if due.IsZero() {
+		return
+	}
+	wait := due.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(wait, w.fire)
+	} else {
+		w.timer.Reset(wait)
+	}
+}
+
+// stop cancels the timer of the watcher, no more events are derived
+func (w *bookWatcher) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (w *bookWatcher) diffSide(evs []interface{}, side common.OrderSide, prev, cur []book.Book) []interface{} {
+	if bestChanged(prev, cur) {
+		ev := &BookBestPriceChanged{Symbol: w.symbol, Side: side, Empty: len(cur) == 0}
+		if len(cur) > 0 {
+			ev.Price, ev.Amount = cur[0].Price, cur[0].Amount
+		}
+		if len(prev) > 0 {
+			ev.PrevPrice = prev[0].Price
+		}
+		evs = append(evs, ev)
+	}
+	prices := make(map[float64]bool, len(cur))
+	for _, l := range cur {
+		prices[l.Price] = true
+	}
+	for i, l := range prev {
+		if !prices[l.Price] {
+			evs = append(evs, &BookLevelChanged{Symbol: w.symbol, Side: side, Kind: BookLevelRemoved, Rank: i, Level: l})
+		}
+	}
+	prices = make(map[float64]bool, len(prev))
+	for _, l := range prev {
+		prices[l.Price] = true
+	}
+	for i, l := range cur {
+		if !prices[l.Price] {
+			evs = append(evs, &BookLevelChanged{Symbol: w.symbol, Side: side, Kind: BookLevelAdded, Rank: i, Level: l})
+		}
+	}
+	return evs
+}
+
+func bestChanged(prev, cur []book.Book) bool {
+	if len(prev) == 0 || len(cur) == 0 {
+		return len(prev) != len(cur)
+	}
+	return prev[0].Price != cur[0].Price || prev[0].Amount != cur[0].Amount
+}
+
+// SubscribeBookEvents subscribes to the book of the given symbol like SubscribeBook
+// and additionally publishes BookBestPriceChanged, BookLevelChanged and
+// BookTopSnapshot events derived from the managed Orderbook. This requires
+// ManageOrderbook=True and is only supported for aggregated trading books.
+func (c *Client) SubscribeBookEvents(ctx context.Context, symbol string, precision common.BookPrecision, frequency common.BookFrequency, priceLevel int, opts BookEventOptions) (string, error) {
+	if !c.parameters.ManageOrderbook {
+		return "", fmt.Errorf("book events require ManageOrderbook")
+	}
+	if book.IsRawBook(string(precision)) || book.IsFundingBook(symbol) {
+		return "", fmt.Errorf("book events are not supported for raw or funding book %s", symbol)
+	}
+	w := newBookWatcher(symbol, opts)
+	w.fire = func() { c.flushBookEvents(w) }
+	c.mtx.Lock()
+	if old, ok := c.bookWatchers[symbol]; ok {
+		old.stop()
+	}
+	c.bookWatchers[symbol] = w
+	c.mtx.Unlock()
+	subID, err := c.SubscribeBook(ctx, symbol, precision, frequency, priceLevel)
+	if err != nil {
+		c.unwatchBook(&SubscriptionRequest{Channel: ChanBook, Symbol: symbol})
+	}
+	return subID, err
+}
+
+// publishBookEvents publishes the derived events of a watched book after it has
+// been updated, or flushes coalesced changes on a heartbeat.
+func (c *Client) publishBookEvents(sub *subscription, flush bool) {
+	if sub.Request.Channel != ChanBook || book.IsRawBook(sub.Request.Precision) || c.subscriptions.isResyncing(sub) {
+		return
+	}
+	c.mtx.RLock()
+	w, ok := c.bookWatchers[sub.Request.Symbol]
+	ob, hasBook := c.orderbooks[sub.Request.Symbol]
+	c.mtx.RUnlock()
+	if !ok || !hasBook {
+		return
+	}
+	for _, ev := range w.events(ob, time.Now(), flush) {
+		c.publish(ev)
+	}
+}
+
+// flushBookEvents publishes the changes of a watched book held back by the
+// throttle and the periodic snapshot when the timer of the watcher expires
+func (c *Client) flushBookEvents(w *bookWatcher) {
+	subs := c.subscriptions.lookupByRequest(func(r *SubscriptionRequest) bool {
+		return r.Channel == ChanBook && r.Symbol == w.symbol && !book.IsRawBook(r.Precision)
+	})
+	for _, sub := range subs {
+		if c.subscriptions.isResyncing(sub) {
+			// the book is rebuilt, events resume with the new snapshot
+			return
+		}
+	}
+	c.mtx.RLock()
+	ob, ok := c.orderbooks[w.symbol]
+	c.mtx.RUnlock()
+	if !ok {
+		return
+	}
+	for _, ev := range w.events(ob, time.Now(), true) {
+		c.publish(ev)
+	}
+}
+
+// stop publishing derived events once the book subscription is removed
+func (c *Client) unwatchBook(req *SubscriptionRequest) {
+	if req.Channel != ChanBook {
+		return
+	}
+	c.mtx.Lock()
+	if w, ok := c.bookWatchers[req.Symbol]; ok {
+		w.stop()
+		delete(c.bookWatchers, req.Symbol)
+	}
+	c.mtx.Unlock()
+}
+
+// stopBookWatchers cancels the timers of all watched books
+func (c *Client) stopBookWatchers() {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for _, w := range c.bookWatchers {
+		w.stop()
+	}
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+func TestBookWatcherEvents(t *testing.T) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testLevel(100, 1, 1),
+		testLevel(99, 1, 2),
+		testLevel(101, 1, -1),
+	}})
+	w := newBookWatcher("tBTCUSD", BookEventOptions{TopN: 2, Throttle: time.Second, SnapshotInterval: time.Minute})
+	now := time.Now()
+
+	// first evaluation publishes both best prices, all levels and a snapshot
+	evs := w.events(ob, now, false)
+	assert.Len(t, evs, 6)
+	assert.Equal(t, &BookBestPriceChanged{Symbol: "tBTCUSD", Side: common.Bid, Price: 100, Amount: 1}, evs[0])
+	snap := evs[5].(*BookTopSnapshot)
+	assert.Len(t, snap.Bids, 2)
+	assert.Len(t, snap.Asks, 1)
+
+	// changes within the throttle window are coalesced
+	ob.UpdateWith(testLevel(100.5, 1, 3))
+	assert.Empty(t, w.events(ob, now.Add(time.Millisecond*100), false))
+	ob.UpdateWith(testLevel(101, 0, -1))
+	assert.Empty(t, w.events(ob, now.Add(time.Millisecond*200), false))
+
+	// flushed once the window has passed
+	evs = w.events(ob, now.Add(time.Second), true)
+	assert.Equal(t, []interface{}{
+		&BookBestPriceChanged{Symbol: "tBTCUSD", Side: common.Bid, Price: 100.5, Amount: 3, PrevPrice: 100},
+		&BookLevelChanged{Symbol: "tBTCUSD", Side: common.Bid, Kind: BookLevelRemoved, Rank: 1, Level: *testLevel(99, 1, 2)},
+		&BookLevelChanged{Symbol: "tBTCUSD", Side: common.Bid, Kind: BookLevelAdded, Rank: 0, Level: *testLevel(100.5, 1, 3)},
+		&BookBestPriceChanged{Symbol: "tBTCUSD", Side: common.Ask, PrevPrice: 101, Empty: true},
+		&BookLevelChanged{Symbol: "tBTCUSD", Side: common.Ask, Kind: BookLevelRemoved, Rank: 0, Level: *testLevel(101, 1, -1)},
+	}, evs)
+
+	// nothing pending, heartbeat flush is a no-op
+	assert.Empty(t, w.events(ob, now.Add(time.Second*3), true))
+}
+
+func TestBookWatcherTimer(t *testing.T) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testLevel(100, 1, 1),
+		testLevel(101, 1, -1),
+	}})
+	w := newBookWatcher("tBTCUSD", BookEventOptions{TopN: 1, Throttle: time.Millisecond * 50, SnapshotInterval: time.Millisecond * 200})
+	fired := make(chan []interface{}, 8)
+	w.fire = func() { fired <- w.events(ob, time.Now(), true) }
+	next := func() []interface{} {
+		select {
+		case evs := <-fired:
+			return evs
+		case <-time.After(time.Second):
+			t.Fatal("timer did not fire")
+			return nil
+		}
+	}
+
+	evs := w.events(ob, time.Now(), false)
+	assert.Len(t, evs, 5)
+
+	// the throttled change is flushed without another update
+	ob.UpdateWith(testLevel(100.5, 1, 3))
+	assert.Empty(t, w.events(ob, time.Now(), false))
+	evs = next()
+	assert.Contains(t, evs, &BookBestPriceChanged{Symbol: "tBTCUSD", Side: common.Bid, Price: 100.5, Amount: 3, PrevPrice: 100})
+
+	// the snapshot is sent on a quiet book
+	var snap *BookTopSnapshot
+	for snap == nil {
+		for _, ev := range next() {
+			if s, ok := ev.(*BookTopSnapshot); ok {
+				snap = s
+			}
+		}
+	}
+	assert.Equal(t, 100.5, snap.Bids[0].Price)
+
+	// no more events once stopped
+	w.stop()
+	select {
+	case evs := <-fired:
+		assert.Empty(t, evs)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// managedBook is implemented by all locally managed order books.
+type managedBook interface {
+	Checksum() uint32
+	SetWithSnapshot(bs *book.Snapshot)
+}
+
+// BookResync is published on the listener channel when a managed order book
+// failed checksum verification and is being rebuilt from a new subscription.
+type BookResync struct {
+	Symbol     string
+	Precision  string
+	OldSubID   string
+	NewSubID   string
+	Expected   uint32 // checksum sent by bitfinex
+	Calculated uint32 // checksum of the local book
+	// number of mismatches since the book was last verified successfully
+	ConsecutiveMismatches int
+	// delay before the book is resubscribed
+	Backoff time.Duration
+}
+
+// BookChecksumStats counts the checksum verifications of a managed order book.
+type BookChecksumStats struct {
+	Verified              int64
+	Mismatches            int64
+	ConsecutiveMismatches int
+	Resyncs               int64
+	LastMismatch          time.Time
+}
+
+type bookChecksums struct {
+	lock  sync.Mutex
+	stats map[string]*BookChecksumStats
+}
+
+func newBookChecksums() *bookChecksums {
+	return &bookChecksums{stats: make(map[string]*BookChecksumStats)}
+}
+
+func bookKey(symbol, precision string) string {
+	return symbol + ":" + precision
+}
+
+func (b *bookChecksums) get(key string) *BookChecksumStats {
+	if s, ok := b.stats[key]; ok {
+		return s
+	}
+	s := &BookChecksumStats{}
+	b.stats[key] = s
+	return s
+}
+
+func (b *bookChecksums) verified(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.get(key)
+	s.Verified++
+	s.ConsecutiveMismatches = 0
+}
+
+// mismatch records a failed verification and returns the consecutive count.
+// Mismatches of a subscription being resynced don't add to the consecutive
+// count, they are already being handled.
+func (b *bookChecksums) mismatch(key string, resyncing bool) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.get(key)
+	s.Mismatches++
+	if !resyncing {
+		s.ConsecutiveMismatches++
+	}
+	s.LastMismatch = time.Now()
+	return s.ConsecutiveMismatches
+}
+
+// resynced records a resubscribe issued to rebuild a book
+func (b *bookChecksums) resynced(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.get(key).Resyncs++
+}
+
+func (b *bookChecksums) snapshot(key string) BookChecksumStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if s, ok := b.stats[key]; ok {
+		return *s
+	}
+	return BookChecksumStats{}
+}
+
+// GetBookChecksumStats returns the checksum verification counters of the
+// managed book with the given symbol and precision.
+func (c *Client) GetBookChecksumStats(symbol string, precision common.BookPrecision) BookChecksumStats {
+	return c.bookChecksums.snapshot(bookKey(symbol, string(precision)))
+}
+
+// lookup the managed book for the given subscription, callers must hold c.mtx
+func (c *Client) lookupManagedBook(req *SubscriptionRequest) managedBook {
+	if book.IsRawBook(req.Precision) {
+		if ob, ok := c.rawOrderbooks[req.Symbol]; ok {
+			return ob
+		}
+	} else if book.IsFundingBook(req.Symbol) {
+		if ob, ok := c.fundingBooks[req.Symbol]; ok {
+			return ob
+		}
+	} else if ob, ok := c.orderbooks[req.Symbol]; ok {
+		return ob
+	}
+	return nil
+}
+
+// resyncBackoff returns no delay for the first mismatch, then BookResyncBackoff
+// doubled for every further consecutive mismatch, capped at BookResyncMaxBackoff.
+func (c *Client) resyncBackoff(consecutive int) time.Duration {
+	backoff := c.parameters.BookResyncBackoff
+	if consecutive <= 1 || backoff <= 0 {
+		return 0
+	}
+	max := c.parameters.BookResyncMaxBackoff
+	for i := 2; i < consecutive && (max <= 0 || backoff < max); i++ {
+		backoff *= 2
+	}
+	if max > 0 && backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// resyncBook drops the subscription of an out of sync book, clears the book and
+// resubscribes with the original subscription parameters.
+func (c *Client) resyncBook(sub *subscription, orderbook managedBook, expected, calculated uint32) error {
+	if !c.subscriptions.startResync(sub) {
+		// already being resubscribed
+		return nil
+	}
+	key := bookKey(sub.Request.Symbol, sub.Request.Precision)
+	consecutive := c.bookChecksums.mismatch(key, false)
+	backoff := c.resyncBackoff(consecutive)
+
+	err := c.sendUnsubscribeMessage(context.Background(), sub)
+	if err != nil {
+		return err
+	}
+	// discard the stale book, it is rebuilt from the snapshot of the new subscription
+	orderbook.SetWithSnapshot(&book.Snapshot{})
+
+	newReq := *sub.Request
+	newReq.SubID = c.nonce.GetNonce() // generate new subID
+	c.publish(&BookResync{
+		Symbol:                sub.Request.Symbol,
+		Precision:             sub.Request.Precision,
+		OldSubID:              sub.SubID(),
+		NewSubID:              newReq.SubID,
+		Expected:              expected,
+		Calculated:            calculated,
+		ConsecutiveMismatches: consecutive,
+		Backoff:               backoff,
+	})
+
+	resubscribe := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		c.bookChecksums.resynced(key)
+		_, err := c.Subscribe(ctx, &newReq)
+		if err != nil {
+			c.log.Warningf("could not resubscribe: %s", err.Error())
+		}
+		return err
+	}
+	if backoff == 0 {
+		return resubscribe()
+	}
+	c.subLog(sub).Infof("Orderbook '%s' resubscribing in %s after %d consecutive checksum mismatches", sub.Request.Symbol, backoff, consecutive)
+	c.spawn(func() {
+		if c.sleep(backoff) {
+			_ = resubscribe()
+		}
+	})
+	return nil
+}
+
+func (c *Client) handleChecksumChannel(sub *subscription, checksum int) error {
+	symbol := sub.Request.Symbol
+	// force to signed integer
+	bChecksum := uint32(checksum)
+	c.mtx.Lock()
+	orderbook := c.lookupManagedBook(sub.Request)
+	c.mtx.Unlock()
+	if orderbook == nil {
+		return nil
+	}
+	oChecksum := orderbook.Checksum()
+	if c.subscriptions.isResyncing(sub) {
+		// subscription is being dropped, only count mismatches until unsubscribed
+		if bChecksum != oChecksum {
+			c.bookChecksums.mismatch(bookKey(symbol, sub.Request.Precision), true)
+		}
+		return nil
+	}
+	// compare bitfinex checksum with local checksum
+	if bChecksum == oChecksum {
+		c.log.Debugf("Orderbook '%s' checksum verification successful.", symbol)
+		c.bookChecksums.verified(bookKey(symbol, sub.Request.Precision))
+		return nil
+	}
+	c.subLog(sub).Warningf("Orderbook '%s' checksum is invalid got %d but got %d. Data out of sync, resubscribing.",
+		symbol, bChecksum, oChecksum)
+	if err := c.resyncBook(sub, orderbook, bChecksum, oChecksum); err != nil {
+		return fmt.Errorf("could not resync orderbook %s: %s", symbol, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/fundinginfo"
+	"github.com/vx416/bitfinex-api-go/pkg/models/margin"
+	"github.com/vx416/bitfinex-api-go/pkg/models/position"
+	"github.com/vx416/bitfinex-api-go/pkg/models/wallet"
+)
+
+// CalcMarginBase requests a recalculation of the account wide margin info,
+// answered with a margin.InfoBase.
+const CalcMarginBase = "margin_base"
+
+// CalcMarginSymbol returns the calc key of the margin info of a symbol,
+// answered with a margin.InfoUpdate.
+func CalcMarginSymbol(symbol string) string {
+	return "margin_sym_" + symbol
+}
+
+// CalcFundingSymbol returns the calc key of the funding info of a symbol,
+// answered with a fundinginfo.FundingInfo.
+func CalcFundingSymbol(symbol string) string {
+	return "funding_sym_" + symbol
+}
+
+// CalcPosition returns the calc key of the position on a symbol, answered with
+// a position.Update.
+func CalcPosition(symbol string) string {
+	return "position_" + symbol
+}
+
+// CalcWallet returns the calc key of a wallet, answered with a wallet.Update.
+func CalcWallet(walletType, currency string) string {
+	return "wallet_" + walletType + "_" + currency
+}
+
+// CalcRequest asks the server to recalculate the given keys and publish the
+// fresh values on the authenticated channel.
+type CalcRequest struct {
+	Keys []string
+}
+
+// MarshalJSON converts the calc request into the format required by the
+// bitfinex websocket service.
+func (cr *CalcRequest) MarshalJSON() ([]byte, error) {
+	keys := make([][]string, len(cr.Keys))
+	for i, k := range cr.Keys {
+		keys[i] = []string{k}
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"calc\", null, %s]", string(b))), nil
+}
+
+// calcBatcher merges calc requests made within the throttle interval into a
+// single request and tracks callers awaiting the resulting updates.
+type calcBatcher struct {
+	lock     sync.Mutex
+	pending  []string
+	queued   map[string]bool
+	lastSent time.Time
+	timer    *time.Timer
+	stopped  bool // client closed, no flushes are scheduled
+	waiters  map[string][]chan interface{}
+}
+
+func newCalcBatcher() *calcBatcher {
+	return &calcBatcher{
+		queued:  make(map[string]bool),
+		waiters: make(map[string][]chan interface{}),
+	}
+}
+
+func (b *calcBatcher) add(keys []string) {
+	for _, k := range keys {
+		if !b.queued[k] {
+			b.queued[k] = true
+			b.pending = append(b.pending, k)
+		}
+	}
+}
+
+// take returns the request for all pending keys, nil if there are none
+func (b *calcBatcher) take(now time.Time) *CalcRequest {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	req := &CalcRequest{Keys: b.pending}
+	b.pending = nil
+	b.queued = make(map[string]bool)
+	b.lastSent = now
+	return req
+}
+
+func (b *calcBatcher) wait(key string) chan interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ch := make(chan interface{}, 1)
+	b.waiters[key] = append(b.waiters[key], ch)
+	return ch
+}
+
+func (b *calcBatcher) cancel(key string, ch chan interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	waiters := b.waiters[key]
+	for i, w := range waiters {
+		if w == ch {
+			b.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(b.waiters[key]) == 0 {
+		delete(b.waiters, key)
+	}
+}
+
+// resolve hands an update to the callers awaiting its calc key
+func (b *calcBatcher) resolve(obj interface{}) {
+	key := calcKey(obj)
+	if key == "" {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, ch := range b.waiters[key] {
+		ch <- obj
+	}
+	delete(b.waiters, key)
+}
+
+// calcKey returns the calc key an authenticated update answers
+func calcKey(obj interface{}) string {
+	switch o := obj.(type) {
+	case *margin.InfoBase:
+		return CalcMarginBase
+	case *margin.InfoUpdate:
+		return CalcMarginSymbol(o.Symbol)
+	case *fundinginfo.FundingInfo:
+		return CalcFundingSymbol(o.Symbol)
+	case *position.Update:
+		return CalcPosition(o.Symbol)
+	case *wallet.Update:
+		return CalcWallet(o.Type, o.Currency)
+	}
+	return ""
+}
+
+// RequestCalc requests a recalculation of the given keys. The server limits the
+// frequency of calc requests, requests made within CalcThrottle of the last one
+// are merged and sent once the interval has passed. This requires an
+// authenticated connection with calc enabled, see AuthOptions.Calc, the server
+// ignores the request otherwise.
+func (c *Client) RequestCalc(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no calc keys given")
+	}
+	if !c.authCalc {
+		return ErrCalcDisabled
+	}
+	if _, err := c.GetAuthenticatedSocket(); err != nil {
+		return err
+	}
+	b := c.calc
+	b.lock.Lock()
+	if b.stopped {
+		b.lock.Unlock()
+		return ErrWSNotConnected
+	}
+	b.add(keys)
+	if wait := c.parameters.CalcThrottle - time.Since(b.lastSent); wait > 0 {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(wait, c.flushCalc)
+		}
+		b.lock.Unlock()
+		return nil
+	}
+	req := b.take(time.Now())
+	b.lock.Unlock()
+	return c.sendCalc(ctx, req)
+}
+
+// RequestMarginBaseCalc requests a fresh margin.InfoBase
+func (c *Client) RequestMarginBaseCalc(ctx context.Context) error {
+	return c.RequestCalc(ctx, CalcMarginBase)
+}
+
+// RequestMarginCalc requests a fresh margin.InfoUpdate for the given symbol
+func (c *Client) RequestMarginCalc(ctx context.Context, symbol string) error {
+	return c.RequestCalc(ctx, CalcMarginSymbol(symbol))
+}
+
+// RequestFundingCalc requests a fresh fundinginfo.FundingInfo for the given symbol
+func (c *Client) RequestFundingCalc(ctx context.Context, symbol string) error {
+	return c.RequestCalc(ctx, CalcFundingSymbol(symbol))
+}
+
+// RequestPositionCalc requests a fresh position.Update for the given symbol
+func (c *Client) RequestPositionCalc(ctx context.Context, symbol string) error {
+	return c.RequestCalc(ctx, CalcPosition(symbol))
+}
+
+// RequestWalletCalc requests a fresh wallet.Update for the given wallet
+func (c *Client) RequestWalletCalc(ctx context.Context, walletType, currency string) error {
+	return c.RequestCalc(ctx, CalcWallet(walletType, currency))
+}
+
+// AwaitCalc requests a recalculation of the given key and waits for the
+// resulting update, which is published on the listener as well.
+func (c *Client) AwaitCalc(ctx context.Context, key string) (interface{}, error) {
+	ch := c.calc.wait(key)
+	if err := c.RequestCalc(ctx, key); err != nil {
+		c.calc.cancel(key, ch)
+		return nil, err
+	}
+	select {
+	case obj := <-ch:
+		return obj, nil
+	case <-ctx.Done():
+		c.calc.cancel(key, ch)
+		return nil, ctx.Err()
+	}
+}
+
+// stop cancels a pending flush and rejects further requests
+func (b *calcBatcher) stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stopped = true
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+// flushCalc sends the calc requests merged during the throttle interval
+func (c *Client) flushCalc() {
+	b := c.calc
+	b.lock.Lock()
+	b.timer = nil
+	req := b.take(time.Now())
+	b.lock.Unlock()
+	if req == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.parameters.ShutdownTimeout)
+	defer cancel()
+	if err := c.sendCalc(ctx, req); err != nil {
+		c.log.Warningf("could not send calc request for %s: %s", strings.Join(req.Keys, ","), err.Error())
+	}
+}
+
+func (c *Client) sendCalc(ctx context.Context, req *CalcRequest) error {
+	socket, err := c.GetAuthenticatedSocket()
+	if err != nil {
+		return err
+	}
+	return socket.Asynchronous.Send(ctx, req)
+}
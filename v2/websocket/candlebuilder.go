@@ -0,0 +1,420 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/candle"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
+)
+
+// BarKind identifies when a locally built bar is closed.
+type BarKind string
+
+const (
+	BarKindTime   BarKind = "time"
+	BarKindVolume BarKind = "volume"
+	BarKindTick   BarKind = "tick"
+)
+
+// BarSpec describes how trades are aggregated into bars.
+type BarSpec struct {
+	Kind     BarKind
+	Interval time.Duration // time bars
+	Volume   float64       // volume bars, traded amount per bar
+	Ticks    int           // tick bars, trades per bar
+}
+
+// TimeBars closes a bar every interval, aligned to the unix epoch.
+func TimeBars(interval time.Duration) BarSpec {
+	return BarSpec{Kind: BarKindTime, Interval: interval}
+}
+
+// VolumeBars closes a bar once the given amount has traded. Trades crossing
+// the boundary are split between the two bars.
+func VolumeBars(volume float64) BarSpec {
+	return BarSpec{Kind: BarKindVolume, Volume: volume}
+}
+
+// TickBars closes a bar after the given number of trades.
+func TickBars(ticks int) BarSpec {
+	return BarSpec{Kind: BarKindTick, Ticks: ticks}
+}
+
+func (s BarSpec) String() string {
+	switch s.Kind {
+	case BarKindTime:
+		return s.Interval.String()
+	case BarKindVolume:
+		return fmt.Sprintf("%gv", s.Volume)
+	case BarKindTick:
+		return fmt.Sprintf("%dt", s.Ticks)
+	}
+	return string(s.Kind)
+}
+
+func (s BarSpec) validate() error {
+	switch s.Kind {
+	case BarKindTime:
+		if s.Interval < time.Millisecond {
+			return fmt.Errorf("bar interval too short: %s", s.Interval)
+		}
+	case BarKindVolume:
+		if s.Volume <= 0 {
+			return fmt.Errorf("bar volume must be positive: %f", s.Volume)
+		}
+	case BarKindTick:
+		if s.Ticks <= 0 {
+			return fmt.Errorf("bar ticks must be positive: %d", s.Ticks)
+		}
+	default:
+		return fmt.Errorf("unknown bar kind: %s", s.Kind)
+	}
+	return nil
+}
+
+// Bar is an OHLCV bar built locally from the public trades feed. For time bars
+// End is the exclusive end of the interval, otherwise the time of the last trade.
+type Bar struct {
+	Symbol string
+	Spec   BarSpec
+	Start  int64
+	End    int64
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+	Trades int
+	// the bar was seeded from candle history and does not include every trade
+	Seeded bool
+}
+
+func (b *Bar) apply(price, amount float64, mts int64) {
+	if b.Trades == 0 && !b.Seeded {
+		b.Open, b.High, b.Low = price, price, price
+	}
+	b.High = math.Max(b.High, price)
+	b.Low = math.Min(b.Low, price)
+	b.Close = price
+	b.Volume += amount
+	b.Trades++
+	if b.Spec.Kind != BarKindTime {
+		b.End = mts
+	}
+}
+
+// BarOpened is published when the first trade of a new bar is received, or for
+// the bar in progress once it is seeded from candle history.
+type BarOpened struct {
+	Bar
+}
+
+// BarClosed is published with the final state of a bar.
+type BarClosed struct {
+	Bar
+}
+
+// CandleHistory provides the candles used to seed the bar in progress, it is
+// implemented by rest.CandleService.
+type CandleHistory interface {
+	HistoryWithQuery(symbol string, resolution common.CandleResolution, start common.Mts, end common.Mts, limit common.QueryLimit, sort common.SortOrder) (*candle.Snapshot, error)
+}
+
+// seed resolutions, largest first
+var barSeedResolutions = []struct {
+	resolution common.CandleResolution
+	duration   time.Duration
+}{
+	{common.OneDay, time.Hour * 24},
+	{common.TwelveHours, time.Hour * 12},
+	{common.SixHours, time.Hour * 6},
+	{common.ThreeHours, time.Hour * 3},
+	{common.OneHour, time.Hour},
+	{common.ThirtyMinutes, time.Minute * 30},
+	{common.FifteenMinutes, time.Minute * 15},
+	{common.FiveMinutes, time.Minute * 5},
+	{common.OneMinute, time.Minute},
+}
+
+// BarBuilder aggregates the trades of a symbol into bars of a BarSpec.
+type BarBuilder struct {
+	lock sync.Mutex
+
+	symbol string
+	spec   BarSpec
+	bar    *Bar
+	// trades up to this time are already included in the seeded bar
+	seededUntil int64
+	// dedupe trades redelivered by a trades snapshot
+	lastMTS int64
+	seenIDs map[int64]bool
+}
+
+func newBarBuilder(symbol string, spec BarSpec) *BarBuilder {
+	return &BarBuilder{symbol: symbol, spec: spec, seenIDs: make(map[int64]bool)}
+}
+
+func (b *BarBuilder) Symbol() string {
+	return b.symbol
+}
+
+func (b *BarBuilder) Spec() BarSpec {
+	return b.spec
+}
+
+// Current returns a copy of the bar in progress.
+func (b *BarBuilder) Current() (Bar, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.bar == nil {
+		return Bar{}, false
+	}
+	return *b.bar, true
+}
+
+// seed initializes the time bar in progress from the candles of the largest
+// resolution dividing the bar interval and returns the BarOpened event of the
+// seeded bar. Intervals not divisible by one minute and volume or tick bars can
+// not be seeded.
+func (b *BarBuilder) seed(history CandleHistory, now time.Time) ([]interface{}, error) {
+	if b.spec.Kind != BarKindTime {
+		return nil, nil
+	}
+	var resolution common.CandleResolution
+	for _, r := range barSeedResolutions {
+		if b.spec.Interval%r.duration == 0 {
+			resolution = r.resolution
+			break
+		}
+	}
+	if resolution == "" {
+		return nil, nil
+	}
+	interval := b.spec.Interval.Milliseconds()
+	nowMTS := now.UnixNano() / int64(time.Millisecond)
+	start := nowMTS - nowMTS%interval
+	snap, err := history.HistoryWithQuery(b.symbol, resolution, common.Mts(start), common.Mts(nowMTS), 1000, common.OldestFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.seededUntil = nowMTS
+	if snap == nil || len(snap.Snapshot) == 0 {
+		return nil, nil
+	}
+	candles := make([]*candle.Candle, 0, len(snap.Snapshot))
+	for _, c := range snap.Snapshot {
+		if c.MTS >= start {
+			candles = append(candles, c)
+		}
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].MTS < candles[j].MTS })
+	bar := &Bar{Symbol: b.symbol, Spec: b.spec, Start: start, End: start + interval, Seeded: true}
+	bar.Open, bar.High, bar.Low = candles[0].Open, candles[0].High, candles[0].Low
+	for _, c := range candles {
+		bar.High = math.Max(bar.High, c.High)
+		bar.Low = math.Min(bar.Low, c.Low)
+		bar.Close = c.Close
+		bar.Volume += c.Volume
+	}
+	b.bar = bar
+	return []interface{}{&BarOpened{Bar: *bar}}, nil
+}
+
+// add aggregates a trade and returns the resulting BarOpened/BarClosed events
+func (b *BarBuilder) add(t *trade.Trade) []interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if t.MTS <= b.seededUntil || t.MTS < b.lastMTS || (t.MTS == b.lastMTS && b.seenIDs[t.ID]) {
+		return nil
+	}
+	if t.MTS > b.lastMTS {
+		b.lastMTS = t.MTS
+		b.seenIDs = make(map[int64]bool)
+	}
+	b.seenIDs[t.ID] = true
+
+	evs := make([]interface{}, 0)
+	amount := math.Abs(t.Amount)
+	switch b.spec.Kind {
+	case BarKindTime:
+		interval := b.spec.Interval.Milliseconds()
+		start := t.MTS - t.MTS%interval
+		if b.bar != nil && start >= b.bar.End {
+			evs = b.close(evs)
+		}
+		if b.bar == nil {
+			evs = b.open(evs, start, start+interval, t.Price, amount, t.MTS)
+		} else {
+			b.bar.apply(t.Price, amount, t.MTS)
+		}
+	case BarKindTick:
+		if b.bar == nil {
+			evs = b.open(evs, t.MTS, t.MTS, t.Price, amount, t.MTS)
+		} else {
+			b.bar.apply(t.Price, amount, t.MTS)
+		}
+		if b.bar.Trades >= b.spec.Ticks {
+			evs = b.close(evs)
+		}
+	case BarKindVolume:
+		for amount > 0 {
+			fill := amount
+			if b.bar != nil {
+				fill = math.Min(amount, b.spec.Volume-b.bar.Volume)
+				b.bar.apply(t.Price, fill, t.MTS)
+			} else {
+				fill = math.Min(amount, b.spec.Volume)
+				evs = b.open(evs, t.MTS, t.MTS, t.Price, fill, t.MTS)
+			}
+			amount -= fill
+			if b.bar.Volume >= b.spec.Volume {
+				evs = b.close(evs)
+			}
+		}
+	}
+	return evs
+}
+
+func (b *BarBuilder) open(evs []interface{}, start, end int64, price, amount float64, mts int64) []interface{} {
+	b.bar = &Bar{Symbol: b.symbol, Spec: b.spec, Start: start, End: end}
+	b.bar.apply(price, amount, mts)
+	return append(evs, &BarOpened{Bar: *b.bar})
+}
+
+func (b *BarBuilder) close(evs []interface{}) []interface{} {
+	closed := &BarClosed{Bar: *b.bar}
+	b.bar = nil
+	return append(evs, closed)
+}
+
+// expire closes a time bar whose interval has passed without further trades.
+func (b *BarBuilder) expire(now time.Time) []interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.spec.Kind != BarKindTime || b.bar == nil || now.UnixNano()/int64(time.Millisecond) < b.bar.End {
+		return nil
+	}
+	return b.close(make([]interface{}, 0))
+}
+
+// SubscribeBars builds bars of the given spec from the public trades of a
+// trading symbol, publishing BarOpened and BarClosed events. An existing trades
+// subscription for the symbol is reused. If history is given the time bar in
+// progress is seeded from its candles and published as BarOpened, see
+// CandleHistory.
+func (c *Client) SubscribeBars(ctx context.Context, symbol string, spec BarSpec, history CandleHistory) (*BarBuilder, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(symbol, common.TradingPrefix) {
+		return nil, fmt.Errorf("bars are only supported for trading symbols: %s", symbol)
+	}
+	b := newBarBuilder(symbol, spec)
+	var seeded []interface{}
+	if history != nil {
+		var err error
+		if seeded, err = b.seed(history, time.Now()); err != nil {
+			return nil, fmt.Errorf("could not seed %s bars for %s: %s", spec, symbol, err.Error())
+		}
+	}
+	c.mtx.Lock()
+	builders := make([]*BarBuilder, 0, len(c.barBuilders[symbol])+1)
+	c.barBuilders[symbol] = append(append(builders, c.barBuilders[symbol]...), b)
+	c.mtx.Unlock()
+	for _, ev := range seeded {
+		c.publish(ev)
+	}
+
+	existing := c.subscriptions.lookupByRequest(func(r *SubscriptionRequest) bool {
+		return r.Channel == ChanTrades && r.Symbol == symbol
+	})
+	if len(existing) > 0 {
+		return b, nil
+	}
+	if _, err := c.SubscribeTrades(ctx, symbol); err != nil {
+		c.RemoveBars(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// RemoveBars stops building bars with the given builder. The trades
+// subscription is left active.
+func (c *Client) RemoveBars(b *BarBuilder) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	// copy on write, buildBars iterates the slice without holding the lock
+	builders := make([]*BarBuilder, 0, len(c.barBuilders[b.symbol]))
+	for _, builder := range c.barBuilders[b.symbol] {
+		if builder != b {
+			builders = append(builders, builder)
+		}
+	}
+	c.barBuilders[b.symbol] = builders
+	if len(c.barBuilders[b.symbol]) == 0 {
+		delete(c.barBuilders, b.symbol)
+	}
+}
+
+// buildBars feeds public trades into the bar builders of their symbol
+func (c *Client) buildBars(sub *subscription, msg interface{}) {
+	if sub.Request.Channel != ChanTrades {
+		return
+	}
+	c.mtx.RLock()
+	builders := c.barBuilders[sub.Request.Symbol]
+	c.mtx.RUnlock()
+	if len(builders) == 0 {
+		return
+	}
+	var trades []*trade.Trade
+	switch t := msg.(type) {
+	case *trade.Trade:
+		trades = []*trade.Trade{t}
+	case *trade.Snapshot:
+		// snapshots are newest first
+		trades = append(trades, t.Snapshot...)
+		sort.Slice(trades, func(i, j int) bool {
+			if trades[i].MTS != trades[j].MTS {
+				return trades[i].MTS < trades[j].MTS
+			}
+			return trades[i].ID < trades[j].ID
+		})
+	}
+	for _, b := range builders {
+		for _, t := range trades {
+			for _, ev := range b.add(t) {
+				c.publish(ev)
+			}
+		}
+	}
+}
+
+// expireBars closes time bars that ended without trades, checked on heartbeats
+func (c *Client) expireBars(sub *subscription) {
+	if sub.Request.Channel != ChanTrades {
+		return
+	}
+	c.mtx.RLock()
+	builders := c.barBuilders[sub.Request.Symbol]
+	c.mtx.RUnlock()
+	for _, b := range builders {
+		for _, ev := range b.expire(time.Now()) {
+			c.publish(ev)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/candle"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
+)
+
+type testCandleHistory struct {
+	resolution common.CandleResolution
+	candles    []*candle.Candle
+}
+
+func (h *testCandleHistory) HistoryWithQuery(symbol string, resolution common.CandleResolution, start common.Mts, end common.Mts, limit common.QueryLimit, sort common.SortOrder) (*candle.Snapshot, error) {
+	h.resolution = resolution
+	return &candle.Snapshot{Snapshot: h.candles}, nil
+}
+
+func testTrade(id, mts int64, price, amount float64) *trade.Trade {
+	return &trade.Trade{Pair: "tBTCUSD", ID: id, MTS: mts, Price: price, Amount: amount}
+}
+
+func TestBarBuilderTimeBars(t *testing.T) {
+	b := newBarBuilder("tBTCUSD", TimeBars(time.Second*10))
+
+	evs := b.add(testTrade(1, 10000, 100, 1))
+	assert.Len(t, evs, 1)
+	assert.Equal(t, int64(20000), evs[0].(*BarOpened).End)
+	assert.Empty(t, b.add(testTrade(2, 15000, 105, -2)))
+	// redelivered trade is ignored
+	assert.Empty(t, b.add(testTrade(2, 15000, 105, -2)))
+	assert.Empty(t, b.add(testTrade(3, 15000, 95, 1)))
+
+	evs = b.add(testTrade(4, 31000, 101, 1))
+	assert.Len(t, evs, 2)
+	closed := evs[0].(*BarClosed)
+	assert.Equal(t, Bar{Symbol: "tBTCUSD", Spec: TimeBars(time.Second * 10), Start: 10000, End: 20000,
+		Open: 100, High: 105, Low: 95, Close: 95, Volume: 4, Trades: 3}, closed.Bar)
+	assert.Equal(t, int64(30000), evs[1].(*BarOpened).Start)
+
+	// heartbeat closes the bar once its interval has passed
+	assert.Empty(t, b.expire(time.Unix(0, 39000*int64(time.Millisecond))))
+	assert.Len(t, b.expire(time.Unix(0, 40000*int64(time.Millisecond))), 1)
+	_, ok := b.Current()
+	assert.False(t, ok)
+}
+
+func TestBarBuilderVolumeAndTickBars(t *testing.T) {
+	v := newBarBuilder("tBTCUSD", VolumeBars(2))
+	assert.Len(t, v.add(testTrade(1, 1, 100, 1.5)), 1)
+	// crosses the boundary, split into the next bar
+	evs := v.add(testTrade(2, 2, 101, -1))
+	assert.Len(t, evs, 2)
+	assert.Equal(t, 2.0, evs[0].(*BarClosed).Volume)
+	bar, ok := v.Current()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, bar.Volume)
+	// large trade closes several bars
+	evs = v.add(testTrade(3, 3, 102, 4))
+	assert.Len(t, evs, 4)
+
+	tk := newBarBuilder("tBTCUSD", TickBars(2))
+	assert.Len(t, tk.add(testTrade(1, 1, 100, 1)), 1)
+	evs = tk.add(testTrade(2, 2, 99, 1))
+	assert.Len(t, evs, 1)
+	assert.Equal(t, 99.0, evs[0].(*BarClosed).Low)
+}
+
+func TestBarBuilderSeed(t *testing.T) {
+	b := newBarBuilder("tBTCUSD", TimeBars(time.Minute*10))
+	now := time.Unix(0, 1200000*int64(time.Millisecond)+int64(time.Minute)*4)
+	history := &testCandleHistory{candles: []*candle.Candle{
+		{MTS: 1260000, Open: 101, Close: 103, High: 104, Low: 100, Volume: 2},
+		{MTS: 1200000, Open: 100, Close: 101, High: 102, Low: 99, Volume: 1},
+		{MTS: 1140000, Open: 90, Close: 100, High: 110, Low: 80, Volume: 5},
+	}}
+	evs, err := b.seed(history, now)
+	assert.NoError(t, err)
+	assert.Equal(t, common.FiveMinutes, history.resolution)
+	bar, ok := b.Current()
+	assert.True(t, ok)
+	assert.Equal(t, Bar{Symbol: "tBTCUSD", Spec: TimeBars(time.Minute * 10), Start: 1200000, End: 1800000,
+		Open: 100, High: 104, Low: 99, Close: 103, Volume: 3, Seeded: true}, bar)
+	// the seeded bar is announced like a bar opened by a trade
+	assert.Equal(t, []interface{}{&BarOpened{Bar: bar}}, evs)
+
+	// trades already covered by the candles are skipped
+	assert.Empty(t, b.add(testTrade(1, 1300000, 200, 1)))
+	assert.Empty(t, b.add(testTrade(2, 1500000, 105, 1)))
+	bar, _ = b.Current()
+	assert.Equal(t, 105.0, bar.High)
+	assert.Equal(t, 100.0, bar.Open)
+	assert.Equal(t, 4.0, bar.Volume)
+}
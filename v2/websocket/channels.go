@@ -1,12 +1,12 @@
 package websocket
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/vx416/bitfinex-api-go/pkg/convert"
 	"github.com/vx416/bitfinex-api-go/pkg/models/balanceinfo"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
 	"github.com/vx416/bitfinex-api-go/pkg/models/fundingcredit"
 	"github.com/vx416/bitfinex-api-go/pkg/models/fundinginfo"
 	"github.com/vx416/bitfinex-api-go/pkg/models/fundingloan"
@@ -26,7 +26,7 @@ type Heartbeat struct {
 }
 
 func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
-	if c.terminal {
+	if c.isTerminal() {
 		return fmt.Errorf("received a message after close")
 	}
 
@@ -49,72 +49,53 @@ func (c *Client) handleChannel(socketId SocketId, msg []byte) error {
 		// no subscribed channel for message
 		return err
 	}
+	if c.subscriptions.isMigrated(sub) {
+		// moved to another socket, drop messages still in flight
+		return nil
+	}
 	c.subscriptions.heartbeat(chanID)
+	c.recordMessage(sub)
+	var sq *messageTrailer
+	if socket, err_sock := c.socketById(socketId); err_sock == nil {
+		sq = parseTrailer(socketId, socket.conn.flags, raw, !sub.Public)
+		c.recordLatency(socket, sq)
+		c.checkSequence(socket, sq)
+	}
 	if sub.Public {
 		switch data := raw[1].(type) {
 		case string:
 			switch data {
 			case "hb":
-				// no-op, already updated heartbeat timeout from this event
+				// already updated heartbeat timeout from this event, flush throttled book events and expired bars
+				c.publishBookEvents(sub, true)
+				c.expireBars(sub)
 				return nil
 			case "cs":
 				if checksum, ok := raw[2].(float64); ok {
 					return c.handleChecksumChannel(sub, int(checksum))
 				} else {
-					c.log.Error("Unable to parse checksum")
+					c.log.Errorf("Unable to parse checksum")
 				}
 			default:
 				body := raw[2].([]interface{})
-				return c.handlePublicChannel(sub, sub.Request.Channel, data, body, msg)
+				if m := c.takeOver(sub); m != nil {
+					defer c.completeMigration(sub, m)
+				}
+				return c.handlePublicChannel(sub, sub.Request.Channel, data, body, msg, sq)
 			}
 		case []interface{}:
-			return c.handlePublicChannel(sub, sub.Request.Channel, "", data, msg)
-		}
-	} else {
-		return c.handlePrivateChannel(raw)
-	}
-	return nil
-}
-
-func (c *Client) handleChecksumChannel(sub *subscription, checksum int) error {
-	symbol := sub.Request.Symbol
-	// force to signed integer
-	bChecksum := uint32(checksum)
-	var orderbook *Orderbook
-	c.mtx.Lock()
-	if ob, ok := c.orderbooks[symbol]; ok {
-		orderbook = ob
-	}
-	c.mtx.Unlock()
-	if orderbook != nil {
-		oChecksum := orderbook.Checksum()
-		// compare bitfinex checksum with local checksum
-		if bChecksum == oChecksum {
-			c.log.Debugf("Orderbook '%s' checksum verification successful.", symbol)
-		} else {
-			c.log.Warningf("Orderbook '%s' checksum is invalid got %d bot got %d. Data Out of sync, reconnecting.",
-				symbol, bChecksum, oChecksum)
-			err := c.sendUnsubscribeMessage(context.Background(), sub)
-			if err != nil {
-				return err
-			}
-			newSub := &SubscriptionRequest{
-				SubID:   c.nonce.GetNonce(), // generate new subID
-				Event:   sub.Request.Event,
-				Channel: sub.Request.Channel,
-				Symbol:  sub.Request.Symbol,
-			}
-			_, err_sub := c.Subscribe(context.Background(), newSub)
-			if err_sub != nil {
-				c.log.Warningf("could not resubscribe: %s", err_sub.Error())
-				return err_sub
+			if m := c.takeOver(sub); m != nil {
+				defer c.completeMigration(sub, m)
 			}
+			return c.handlePublicChannel(sub, sub.Request.Channel, "", data, msg, sq)
 		}
+	} else {
+		return c.handlePrivateChannel(raw, sq)
 	}
 	return nil
 }
 
-func (c *Client) handlePublicChannel(sub *subscription, channel, objType string, data []interface{}, raw_msg []byte) error {
+func (c *Client) handlePublicChannel(sub *subscription, channel, objType string, data []interface{}, raw_msg []byte, sq *messageTrailer) error {
 	// unauthenticated data slice
 	// public data is returned as raw interface arrays, use a factory to convert to raw type & publish
 	if factory, ok := c.factories[channel]; ok {
@@ -122,16 +103,24 @@ func (c *Client) handlePublicChannel(sub *subscription, channel, objType string,
 		if len(data) > 0 {
 			if _, ok := data[0].([]interface{}); ok {
 				interfaceArray := convert.ToInterfaceArray(data)
-				// snapshot item
-				c.mtx.Lock()
-				// lock mutex since its mutates client struct
-				msg, err := factory.BuildSnapshot(sub, interfaceArray, raw_msg)
-				c.mtx.Unlock()
+				var msg interface{}
+				var err error
+				if bulk, ok := factory.(bulkMessageFactory); ok && sub.snapshot && c.hasConnFlag(sub.SocketId, common.BulkUpdates) {
+					// batch of updates, only the first frame of the subscription is a snapshot
+					msg, err = bulk.BuildBulk(sub, interfaceArray, raw_msg)
+				} else {
+					// snapshot item
+					c.mtx.Lock()
+					// lock mutex since its mutates client struct
+					msg, err = factory.BuildSnapshot(sub, interfaceArray, raw_msg)
+					c.mtx.Unlock()
+					sub.snapshot = true
+				}
 				if err != nil {
 					return err
 				}
 				if msg != nil {
-					c.listener <- msg
+					c.deliverPublic(sub, msg, sq)
 				}
 			} else {
 				// single item
@@ -140,7 +129,7 @@ func (c *Client) handlePublicChannel(sub *subscription, channel, objType string,
 					return err
 				}
 				if msg != nil {
-					c.listener <- msg
+					c.deliverPublic(sub, msg, sq)
 				}
 			}
 		}
@@ -151,7 +140,20 @@ func (c *Client) handlePublicChannel(sub *subscription, channel, objType string,
 	return nil
 }
 
-func (c *Client) handlePrivateChannel(raw []interface{}) error {
+// deliverPublic publishes a public message and the events derived from it,
+// trades and candles are delivered after the backfill of a reconnect
+func (c *Client) deliverPublic(sub *subscription, msg interface{}, sq *messageTrailer) {
+	c.publishBackfill(sub, msg, func(msg interface{}) {
+		if c.parameters.ManagePositions {
+			c.markPositions(msg)
+		}
+		c.publish(sq.wrap(msg))
+		c.publishBookEvents(sub, false)
+		c.buildBars(sub, msg)
+	})
+}
+
+func (c *Client) handlePrivateChannel(raw []interface{}, sq *messageTrailer) error {
 	// authenticated data slice, or a heartbeat
 	if val, ok := raw[1].(string); ok && val == "hb" {
 		chanID, ok := raw[0].(float64)
@@ -171,7 +173,12 @@ func (c *Client) handlePrivateChannel(raw []interface{}) error {
 				}
 				// private data is returned as strongly typed data, publish directly
 				if obj != nil {
-					c.listener <- obj
+					c.calc.resolve(obj)
+					c.orderOps.resolve(obj)
+					c.publish(sq.wrap(obj))
+					if c.parameters.ManagePositions {
+						c.trackPosition(obj)
+					}
 				}
 			}
 		}
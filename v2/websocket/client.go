@@ -4,13 +4,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
 
 	"github.com/gorilla/websocket"
-	"github.com/op/go-logging"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
 
 	"github.com/vx416/bitfinex-api-go/pkg/models/common"
 	"github.com/vx416/bitfinex-api-go/pkg/utils"
@@ -26,6 +28,8 @@ var productionBaseURL = "wss://api-pub.bitfinex.com/ws/2"
 var (
 	ErrWSNotConnected     = fmt.Errorf("websocket connection not established")
 	ErrWSAlreadyConnected = fmt.Errorf("websocket connection already established")
+	ErrMaintenance        = fmt.Errorf("platform in maintenance, order requests are paused")
+	ErrCalcDisabled       = fmt.Errorf("calc requests are not enabled, see AuthOptions.Calc")
 )
 
 // Available channels
@@ -61,6 +65,52 @@ type AuthState authState // prevent user construction of authStates
 // DMSCancelOnDisconnect cancels session orders on disconnect.
 const DMSCancelOnDisconnect int = 4
 
+// Filters of the authenticated channel, see AuthOptions.
+const (
+	AuthFilterTrading = "trading"
+	AuthFilterFunding = "funding"
+	AuthFilterWallet  = "wallet"
+	AuthFilterBalance = "balance"
+	AuthFilterNotify  = "notify"
+	AuthFilterAlgo    = "algo"
+)
+
+// TradingFilter restricts the authenticated channel to the trading data of a symbol.
+func TradingFilter(symbol string) string {
+	return AuthFilterTrading + "-" + symbol
+}
+
+// FundingFilter restricts the authenticated channel to the funding data of a symbol.
+func FundingFilter(symbol string) string {
+	return AuthFilterFunding + "-" + symbol
+}
+
+// WalletFilter restricts the authenticated channel to the updates of a wallet.
+func WalletFilter(walletType, currency string) string {
+	return AuthFilterWallet + "-" + walletType + "-" + currency
+}
+
+// AuthOptions configures the authentication request of a client. Options left
+// unset keep their current value.
+type AuthOptions struct {
+	// Filter limits the messages of the authenticated channel, e.g.
+	// AuthFilterWallet or TradingFilter("tBTCUSD"). Empty receives everything.
+	Filter []string
+	// CancelOnDisconnect enables the dead man switch, see CancelOnDisconnect.
+	CancelOnDisconnect *bool
+	// Calc enables on-demand calculations, see RequestCalc.
+	Calc *bool
+	// Token authenticates with an auth token instead of the API key and
+	// secret of Credentials.
+	Token string
+}
+
+// Bool returns a pointer to the given value, e.g. to set the flags of
+// AuthOptions.
+func Bool(v bool) *bool {
+	return &v
+}
+
 // Asynchronous interface decouples the underlying transport from API logic.
 type Asynchronous interface {
 	Connect() error
@@ -77,6 +127,9 @@ type Socket struct {
 	IsConnected        bool
 	ResetSubscriptions []*subscription
 	IsAuthenticated    bool
+
+	// conf flags, sequence numbers and latency of the connection
+	conn connState
 }
 
 // AsynchronousFactory provides an interface to re-create asynchronous transports during reconnect events.
@@ -98,7 +151,9 @@ func NewWebsocketAsynchronousFactory(parameters *Parameters) AsynchronousFactory
 
 // Create returns a new websocket transport.
 func (w *WebsocketAsynchronousFactory) Create() Asynchronous {
-	return newWs(w.parameters.URL, w.parameters.LogTransport, w.parameters.Logger)
+	ws := newWs(w.parameters.URL, w.parameters.LogTransport, w.parameters.logger(), w.parameters.metrics())
+	ws.recorder = w.parameters.Recorder
+	return ws
 }
 
 // Client provides a unified interface for users to interact with the Bitfinex V2 Websocket API.
@@ -110,12 +165,16 @@ type Client struct {
 	apiKey             string
 	apiSecret          string
 	cancelOnDisconnect bool
+	authToken          string
+	authFilter         []string
+	authCalc           bool
 	Authentication     AuthState
 	sockets            map[SocketId]*Socket
 	nonce              utils.NonceGenerator
 	terminal           bool
 	init               bool
-	log                *logging.Logger
+	log                logger.Logger
+	metrics            metrics.Sink
 
 	// connection & operational behavior
 	parameters *Parameters
@@ -124,16 +183,32 @@ type Client struct {
 	subscriptions *subscriptions
 	factories     map[string]messageFactory
 	orderbooks    map[string]*Orderbook
-
-	// close signal sent to user on shutdown
-	shutdown chan bool
+	rawOrderbooks map[string]*RawOrderbook
+	fundingBooks  map[string]*FundingOrderbook
+	bookChecksums *bookChecksums
+	bookWatchers  map[string]*bookWatcher
+	barBuilders   map[string][]*BarBuilder
+	backfill      *backfiller // nil unless enabled with WithBackfill
+	positions     *PositionTracker
+	positionSubs  map[string]*markSubscription // mark price feeds of the position tracker by symbol
+	calc          *calcBatcher
+	maintenance   bool // order requests paused until maintenance ends
+	breaker       *circuitBreaker
+	orderOps      *orderOps
+
+	// closed when the client starts shutting down
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	closeOnce    sync.Once
 
 	// downstream listener channel to deliver API objects
-	listener chan interface{}
+	listener       chan interface{}
+	listenerLock   sync.RWMutex // held for reading while publishing
+	listenerClosed bool
 
 	// race management
 	mtx       *sync.RWMutex
-	waitGroup sync.WaitGroup
+	waitGroup sync.WaitGroup // goroutines awaited by Close
 }
 
 // Credentials assigns authentication credentials to a connection request.
@@ -149,6 +224,25 @@ func (c *Client) CancelOnDisconnect(cxl bool) *Client {
 	return c
 }
 
+// WithAuthOptions sets the filters, dead man switch, calc flag and token used to
+// authenticate the connection. Only the options set are changed, so calls
+// compose with each other and with CancelOnDisconnect.
+func (c *Client) WithAuthOptions(opts AuthOptions) *Client {
+	if opts.Filter != nil {
+		c.authFilter = opts.Filter
+	}
+	if opts.CancelOnDisconnect != nil {
+		c.cancelOnDisconnect = *opts.CancelOnDisconnect
+	}
+	if opts.Calc != nil {
+		c.authCalc = *opts.Calc
+	}
+	if opts.Token != "" {
+		c.authToken = opts.Token
+	}
+	return c
+}
+
 func (c *Client) sign(msg string) (string, error) {
 	sig := hmac.New(sha512.New384, []byte(c.apiSecret))
 	_, err := sig.Write([]byte(msg))
@@ -198,16 +292,27 @@ func NewWithParamsAsyncFactoryNonce(params *Parameters, async AsynchronousFactor
 		asyncFactory:   async,
 		Authentication: NoAuthentication,
 		factories:      make(map[string]messageFactory),
-		subscriptions:  newSubscriptions(params.HeartbeatTimeout, params.Logger),
+		subscriptions:  newSubscriptions(params.HeartbeatTimeout, params.logger()),
 		orderbooks:     make(map[string]*Orderbook),
+		rawOrderbooks:  make(map[string]*RawOrderbook),
+		fundingBooks:   make(map[string]*FundingOrderbook),
+		bookChecksums:  newBookChecksums(),
+		bookWatchers:   make(map[string]*bookWatcher),
+		barBuilders:    make(map[string][]*BarBuilder),
+		positions:      newPositionTracker(params.PositionThresholds),
+		positionSubs:   make(map[string]*markSubscription),
+		calc:           newCalcBatcher(),
+		orderOps:       &orderOps{},
+		breaker:        newCircuitBreaker(params.CircuitBreakerThreshold, params.CircuitBreakerCooldown),
 		nonce:          nonce,
 		parameters:     params,
 		listener:       make(chan interface{}),
 		terminal:       false,
-		shutdown:       nil,
+		shutdown:       make(chan struct{}),
 		sockets:        make(map[SocketId]*Socket),
 		mtx:            &sync.RWMutex{},
-		log:            params.Logger,
+		log:            params.logger(),
+		metrics:        params.metrics(),
 	}
 	c.registerPublicFactories()
 	return c
@@ -216,9 +321,8 @@ func NewWithParamsAsyncFactoryNonce(params *Parameters, async AsynchronousFactor
 // Connect to the Bitfinex API, this should only be called once.
 func (c *Client) Connect() error {
 	c.dumpParams()
-	c.terminal = false
-	go c.listenDisconnect()
-	return c.connectSocket(SocketId(len(c.sockets)))
+	c.spawn(c.listenDisconnect)
+	return c.connectSocket(SocketId(c.ConnectionCount()))
 }
 
 // Returns true if the underlying asynchronous transport is connected to an endpoint.
@@ -239,36 +343,13 @@ func (c *Client) Listen() <-chan interface{} {
 	return c.listener
 }
 
-// Close the websocket client which will cause for all
-// active sockets to be exited and the Done() function
-// to be called
-func (c *Client) Close() {
-	c.terminal = true
-	var wg sync.WaitGroup
-	socketCount := len(c.sockets)
-	if socketCount > 0 {
-		for _, socket := range c.sockets {
-			if socket.IsConnected {
-				wg.Add(1)
-				socket.IsConnected = false
-				go func(s *Socket) {
-					c.closeAsyncAndWait(s, c.parameters.ShutdownTimeout)
-					wg.Done()
-				}(socket)
-			}
-		}
-		wg.Wait()
-	}
-	c.subscriptions.Close()
-	close(c.listener)
-}
-
 // Unsubscribe from the existing subscription with the given id
 func (c *Client) Unsubscribe(ctx context.Context, id string) error {
 	sub, err := c.subscriptions.lookupBySubscriptionID(id)
 	if err != nil {
 		return err
 	}
+	c.unwatchBook(sub.Request)
 	// sub is removed from manager on ack from API
 	return c.sendUnsubscribeMessage(ctx, sub)
 }
@@ -280,23 +361,17 @@ func (c *Client) listenDisconnect() {
 			return
 		case hbErr := <-c.subscriptions.ListenDisconnect(): // subscription heartbeat timeout
 			c.log.Warningf("heartbeat disconnect: %s", hbErr.Error.Error())
-			c.mtx.Lock()
-			if socket, ok := c.sockets[hbErr.Subscription.SocketId]; ok {
-				if socket.IsConnected {
-					c.log.Infof("restarting socket (id=%d) connection", socket.Id)
-					socket.IsConnected = false
-					// reconnect to the socket
-					go func() {
-						c.closeAsyncAndWait(socket, c.parameters.ShutdownTimeout)
-						err := c.reconnect(socket, hbErr.Error)
-						if err != nil {
-							c.log.Warningf("socket disconnect: %s", err.Error())
-							return
-						}
-					}()
-				}
+			sub := hbErr.Subscription
+			c.publish(&SubscriptionDropped{
+				SubID:    sub.SubID(),
+				SocketId: sub.SocketId,
+				ChanID:   sub.ChanID,
+				Request:  sub.Request,
+				Error:    hbErr.Error,
+			})
+			if socket, err := c.socketById(sub.SocketId); err == nil {
+				c.restartSocket(socket, hbErr.Error)
 			}
-			c.mtx.Unlock()
 		}
 	}
 }
@@ -319,56 +394,42 @@ func extractSymbolResolutionFromKey(subscription string) (symbol string, resolut
 func (c *Client) registerPublicFactories() {
 	c.registerFactory(ChanTicker, newTickerFactory(c.subscriptions))
 	c.registerFactory(ChanTrades, newTradeFactory(c.subscriptions))
-	c.registerFactory(ChanBook, newBookFactory(c.subscriptions, c.orderbooks, c.parameters.ManageOrderbook))
+	c.registerFactory(ChanBook, newBookFactory(c.subscriptions, c.orderbooks, c.rawOrderbooks, c.fundingBooks, c.parameters.ManageOrderbook))
 	c.registerFactory(ChanCandles, newCandlesFactory(c.subscriptions))
 	c.registerFactory(ChanStatus, newStatsFactory(c.subscriptions))
 }
 
-func (c *Client) reconnect(socket *Socket, err error) error {
-	c.mtx.RLock()
-	if c.terminal {
-		// dont attempt to reconnect if terminal
-		c.mtx.RUnlock()
-		return err
-	}
-	if !c.parameters.AutoReconnect {
-		err := fmt.Errorf("AutoReconnect setting is disabled, do not reconnect: %s", err.Error())
-		c.mtx.RUnlock()
-		return err
-	}
-	c.mtx.RUnlock()
-	reconnectTry := 0
-	for ; reconnectTry < c.parameters.ReconnectAttempts; reconnectTry++ {
-		c.log.Debugf("socket (id=%d) waiting %s until reconnect...", socket.Id, c.parameters.ReconnectInterval)
-		time.Sleep(c.parameters.ReconnectInterval)
-		c.log.Infof("socket (id=%d) reconnect attempt %d/%d", socket.Id, reconnectTry+1, c.parameters.ReconnectAttempts)
-		if err := c.reconnectSocket(socket); err == nil {
-			c.log.Debugf("reconnect OK")
-			return nil
-		}
-		c.log.Warningf("socket (id=%d) reconnect failed: %s", socket.Id, err.Error())
-	}
-	if err != nil {
-		c.log.Errorf("socket (id=%d) could not reconnect: %s", socket.Id, err.Error())
-	}
-	return err
-}
-
 func (c *Client) dumpParams() {
-	c.log.Debug("----Bitfinex Client Parameters----")
+	c.log.Debugf("----Bitfinex Client Parameters----")
 	c.log.Debugf("AutoReconnect=%t", c.parameters.AutoReconnect)
 	c.log.Debugf("CapacityPerConnection=%t", c.parameters.CapacityPerConnection)
+	c.log.Debugf("ShardingPolicy=%T", c.shardingPolicy())
+	c.log.Debugf("Metrics=%T", c.metrics)
+	c.log.Debugf("Recorder=%t", c.parameters.Recorder != nil)
 	c.log.Debugf("ReconnectInterval=%s", c.parameters.ReconnectInterval)
 	c.log.Debugf("ReconnectAttempts=%d", c.parameters.ReconnectAttempts)
+	c.log.Debugf("CircuitBreakerThreshold=%d", c.parameters.CircuitBreakerThreshold)
+	c.log.Debugf("CircuitBreakerCooldown=%s", c.parameters.CircuitBreakerCooldown)
 	c.log.Debugf("ShutdownTimeout=%s", c.parameters.ShutdownTimeout)
 	c.log.Debugf("ResubscribeOnReconnect=%t", c.parameters.ResubscribeOnReconnect)
 	c.log.Debugf("HeartbeatTimeout=%s", c.parameters.HeartbeatTimeout)
 	c.log.Debugf("URL=%s", c.parameters.URL)
 	c.log.Debugf("ManageOrderbook=%t", c.parameters.ManageOrderbook)
+	c.log.Debugf("BookResyncBackoff=%s", c.parameters.BookResyncBackoff)
+	c.log.Debugf("ManagePositions=%t", c.parameters.ManagePositions)
+	c.log.Debugf("ManageSequence=%t", c.parameters.ManageSequence)
+	c.log.Debugf("ServerTimestamps=%t", c.parameters.ServerTimestamps)
+	c.log.Debugf("BulkBookUpdates=%t", c.parameters.BulkBookUpdates)
+	c.log.Debugf("CalcThrottle=%s", c.parameters.CalcThrottle)
+	c.log.Debugf("PingInterval=%s", c.parameters.PingInterval)
+	c.log.Debugf("PongTimeout=%s", c.parameters.PongTimeout)
 }
 
 func (c *Client) connectSocket(socketId SocketId) error {
 	async := c.asyncFactory.Create()
+	if s, ok := async.(socketAware); ok {
+		s.setSocketId(socketId)
+	}
 	// create new socket instance
 	socket := &Socket{
 		Id:                 socketId,
@@ -377,13 +438,20 @@ func (c *Client) connectSocket(socketId SocketId) error {
 		ResetSubscriptions: nil,
 		IsAuthenticated:    false,
 	}
+	socket.conn.pings = newPingTracker()
+	socket.conn.done = make(chan struct{})
 	oldSocket, _ := c.socketById(socketId)
 	if oldSocket != nil {
 		// socket exists so use its state
 		socket.IsAuthenticated = oldSocket.IsAuthenticated
 		socket.ResetSubscriptions = oldSocket.ResetSubscriptions
+		socket.conn.reconnects = oldSocket.conn.reconnects + 1
 	}
 	c.mtx.Lock()
+	if c.terminal {
+		c.mtx.Unlock()
+		return errClosed
+	}
 	// add socket to managed map
 	c.sockets[socket.Id] = socket
 	c.mtx.Unlock()
@@ -393,8 +461,24 @@ func (c *Client) connectSocket(socketId SocketId) error {
 		// unable to establish connection
 		return err
 	}
+	c.mtx.Lock()
+	if c.terminal {
+		// closed while connecting, Close did not see the connection
+		c.mtx.Unlock()
+		c.closeAsyncAndWait(socket, c.parameters.ShutdownTimeout)
+		return errClosed
+	}
 	socket.IsConnected = true
-	go c.listenUpstream(socket)
+	c.waitGroup.Add(2)
+	c.mtx.Unlock()
+	go func() {
+		defer c.waitGroup.Done()
+		c.listenUpstream(socket)
+	}()
+	go func() {
+		defer c.waitGroup.Done()
+		c.pingLoop(socket)
+	}()
 	return nil
 }
 
@@ -417,16 +501,19 @@ func (c *Client) listenUpstream(socket *Socket) {
 	for {
 		select {
 		case err := <-socket.Asynchronous.Done():
+			// stop pinging before reconnecting
+			close(socket.conn.done)
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
 				err := c.reconnect(socket, err)
 				if err != nil {
-					c.log.Errorf("Unable to reconnect socket (id=%d) after err: %s", socket.Id, err.Error())
+					c.socketLog(socket.Id).Errorf("Unable to reconnect socket after err: %s", err.Error())
 					return
 				}
 			}
 			return
 		case msg := <-socket.Asynchronous.Listen():
 			if msg != nil {
+				socket.conn.touch(time.Now())
 				err := c.handleMessage(socket.Id, msg)
 				if err != nil {
 					c.log.Warningf("upstream listen error: %s", err.Error())
@@ -437,24 +524,19 @@ func (c *Client) listenUpstream(socket *Socket) {
 }
 
 func (c *Client) closeAsyncAndWait(socket *Socket, t time.Duration) {
-	timeout := make(chan bool)
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+	closed := make(chan struct{})
 	go func() {
+		defer close(closed)
+		timeout := time.NewTimer(t)
+		defer timeout.Stop()
 		select {
 		case <-socket.Asynchronous.Done():
-			wg.Done()
-		case <-timeout:
-			c.log.Errorf("socket (id=%d) took too long to close.", socket.Id)
-			wg.Done()
+		case <-timeout.C:
+			c.socketLog(socket.Id).Errorf("socket took too long to close.")
 		}
 	}()
-	go func() {
-		time.Sleep(t)
-		close(timeout)
-	}()
 	socket.Asynchronous.Close()
-	wg.Wait()
+	<-closed
 }
 
 func (c *Client) handleMessage(socketId SocketId, msg []byte) error {
@@ -479,28 +561,50 @@ func (c *Client) sendUnsubscribeMessage(ctx context.Context, sub *subscription)
 	return socket.Asynchronous.Send(ctx, unsubscribeMsg{Event: "unsubscribe", ChanID: sub.ChanID})
 }
 
+// connFlags combines the conf flags required by the client parameters, a conf
+// message replaces all flags previously set on the connection.
+func (c *Client) connFlags() int {
+	flags := 0
+	if c.parameters.ManageOrderbook {
+		flags |= common.Checksum
+	}
+	if c.parameters.ManageSequence {
+		flags |= common.SeqAll
+	}
+	if c.parameters.ServerTimestamps {
+		flags |= common.Timestamp
+	}
+	if c.parameters.BulkBookUpdates {
+		flags |= common.BulkUpdates
+	}
+	return flags
+}
+
 func (c *Client) checkResubscription(socketId SocketId) {
 	socket, err := c.socketById(socketId)
 	if err != nil {
 		panic(err)
 	}
-	if c.parameters.ManageOrderbook {
+	if flags := c.connFlags(); flags != 0 {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
-		_, err_flag := c.EnableFlag(ctx, common.Checksum)
+		_, err_flag := c.EnableFlag(ctx, flags)
 		if err_flag != nil {
-			c.log.Errorf("could not enable checksum flag %s ", err_flag)
+			c.log.Errorf("could not enable conf flags %d: %s", flags, err_flag)
 		}
 	}
 	if c.parameters.ResubscribeOnReconnect && socket.ResetSubscriptions != nil {
 		for _, sub := range socket.ResetSubscriptions {
-			if sub.Request.Event == "auth" {
+			if sub.Request.Event == "auth" || c.subscriptions.isMigrated(sub) {
 				continue
 			}
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 			defer cancel()
 			sub.Request.SubID = c.nonce.GetNonce() // new nonce
-			c.log.Infof("socket (id=%d) resubscribing to %s with nonce %s", socket.Id, sub.Request.String(), sub.Request.SubID)
+			if c.backfill != nil {
+				c.backfill.expect(sub.Request)
+			}
+			c.socketLog(socket.Id).Infof("resubscribing to %s with nonce %s", sub.Request.String(), sub.Request.SubID)
 			_, err := c.subscribeBySocket(ctx, socket, sub.Request)
 			if err != nil {
 				c.log.Errorf("could not resubscribe: %s", err.Error())
@@ -550,36 +654,47 @@ func (c *Client) handleAuthAck(socketId SocketId, auth *AuthEvent) {
 		}
 		c.checkResubscription(socketId)
 	} else {
-		c.log.Error("authentication failed")
+		c.log.Errorf("authentication failed")
 	}
 }
 
 func (c *Client) hasCredentials() bool {
-	return c.apiKey != "" && c.apiSecret != ""
+	return (c.apiKey != "" && c.apiSecret != "") || c.authToken != ""
 }
 
 // Authenticate creates the payload for the authentication request and sends it
 // to the API. The filters will be applied to the authenticated channel, i.e.
-// only subscribe to the filtered messages.
+// only subscribe to the filtered messages. Without filters those of
+// AuthOptions are used.
 func (c *Client) authenticate(ctx context.Context, socketId SocketId, filter ...string) error {
-	nonce := c.nonce.GetNonce()
-	payload := "AUTH" + nonce
-	sig, err := c.sign(payload)
-	if err != nil {
-		return err
+	if len(filter) == 0 {
+		filter = c.authFilter
 	}
+	nonce := c.nonce.GetNonce()
 	s := &SubscriptionRequest{
-		Event:       "auth",
-		APIKey:      c.apiKey,
-		AuthSig:     sig,
-		AuthPayload: payload,
-		AuthNonce:   nonce,
-		Filter:      filter,
-		SubID:       nonce,
+		Event:  "auth",
+		Filter: filter,
+		SubID:  nonce,
+	}
+	if c.authToken != "" {
+		s.Token = c.authToken
+	} else {
+		payload := "AUTH" + nonce
+		sig, err := c.sign(payload)
+		if err != nil {
+			return err
+		}
+		s.APIKey = c.apiKey
+		s.AuthSig = sig
+		s.AuthPayload = payload
+		s.AuthNonce = nonce
 	}
 	if c.cancelOnDisconnect {
 		s.DMS = DMSCancelOnDisconnect
 	}
+	if c.authCalc {
+		s.Calc = 1
+	}
 	c.subscriptions.add(socketId, s)
 	socket, err := c.socketById(socketId)
 	if err != nil {
@@ -600,25 +715,58 @@ func (c *Client) getSocket() (*Socket, error) {
 	return c.sockets[0], nil
 }
 
-func (c *Client) getMostAvailableSocket() (*Socket, error) {
-	var retSocket *Socket
-	bestCapacity := 0
-	for _, socket := range c.sockets {
-		capac := c.getAvailableSocketCapacity(socket.Id)
-		if retSocket == nil {
-			retSocket = socket
-			bestCapacity = capac
-			continue
-		}
-		if capac > bestCapacity {
-			retSocket = socket
-			bestCapacity = capac
-		}
+// socketLog returns the logger with the id of the given socket attached
+func (c *Client) socketLog(socketId SocketId) logger.Logger {
+	return c.log.With(logger.SocketID(int(socketId)))
+}
+
+// subLog returns the logger with the socket, channel and subscription ids and
+// the symbol of the given subscription attached
+func (c *Client) subLog(sub *subscription) logger.Logger {
+	return c.log.With(logger.SocketID(int(sub.SocketId)), logger.ChanID(sub.ChanID), logger.SubID(sub.SubID()), logger.Symbol(sub.Request.Symbol))
+}
+
+func socketLabels(socketId SocketId) metrics.Labels {
+	return metrics.Labels{"socket_id": strconv.Itoa(int(socketId))}
+}
+
+// recordMessage counts a message received on the channel of the given subscription
+func (c *Client) recordMessage(sub *subscription) {
+	channel, symbol := sub.Request.Channel, sub.Request.Symbol
+	if !sub.Public {
+		channel = "auth"
 	}
-	if retSocket == nil {
-		return nil, fmt.Errorf("no socket found")
+	if symbol == "" {
+		symbol = sub.Request.Key
+	}
+	labels := socketLabels(sub.SocketId)
+	labels["channel"] = channel
+	labels["symbol"] = symbol
+	c.metrics.IncCounter(metrics.WsMessages, labels, 1)
+}
+
+// recordSubscriptions sets the number of subscriptions held by the given socket
+func (c *Client) recordSubscriptions(socketId SocketId) {
+	count := 0
+	if set, err := c.subscriptions.lookupBySocketId(socketId); err == nil {
+		count = set.Len()
 	}
-	return retSocket, nil
+	c.metrics.SetGauge(metrics.WsSubscriptions, socketLabels(socketId), float64(count))
+}
+
+func (c *Client) recordReconnect(socketId SocketId, err error) {
+	labels := socketLabels(socketId)
+	labels["result"] = "ok"
+	if err != nil {
+		labels["result"] = "failed"
+	}
+	c.metrics.IncCounter(metrics.WsReconnects, labels, 1)
+}
+
+func (c *Client) recordSequenceGap(gap *SequenceGap) {
+	labels := socketLabels(gap.SocketId)
+	labels["private"] = strconv.FormatBool(gap.Private)
+	c.metrics.IncCounter(metrics.WsSequenceGaps, labels, 1)
 }
 
 // lookup the socket with the given Id, throw error if not found
@@ -20,6 +20,9 @@ type PlatformInfo struct {
 	Status int `json:"status"`
 }
 
+// PlatformOperative is the platform status of info events outside maintenance.
+const PlatformOperative = 1
+
 type RawEvent struct {
 	Data interface{}
 }
@@ -50,6 +53,13 @@ type Capabilities struct {
 	Positions Capability `json:"positions"`
 }
 
+// info codes pulled from v2 docs
+const (
+	InfoCodeServerRestart    int = 20051
+	InfoCodeMaintenanceStart int = 20060
+	InfoCodeMaintenanceEnd   int = 20061
+)
+
 // error codes pulled from v2 docs & API usage
 const (
 	ErrorCodeUnknownEvent         int = 10000
@@ -120,8 +130,12 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 			if err_open != nil {
 				return err_open
 			}
+			c.handlePlatformStatus(socketId, &i, msg)
+		}
+		c.publish(&i)
+		if i.Code != 0 {
+			c.handleInfoCode(socketId, &i)
 		}
-		c.listener <- &i
 	case "auth":
 		a := AuthEvent{}
 		err = json.Unmarshal(msg, &a)
@@ -134,7 +148,7 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 			c.Authentication = RejectedAuthentication
 		}
 		c.handleAuthAck(socketId, &a)
-		c.listener <- &a
+		c.publish(&a)
 		return nil
 	case "subscribed":
 		s := SubscribeEvent{}
@@ -146,7 +160,10 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 		if err != nil {
 			return err
 		}
-		c.listener <- &s
+		c.publish(&s)
+		if sub, err_sub := c.subscriptions.lookupBySubscriptionID(s.SubID); err_sub == nil {
+			c.publish(&SubscriptionActivated{SubID: s.SubID, SocketId: socketId, ChanID: s.ChanID, Request: sub.Request})
+		}
 		return nil
 	case "unsubscribed":
 		s := UnsubscribeEvent{}
@@ -154,25 +171,43 @@ func (c *Client) handleEvent(socketId SocketId, msg []byte) error {
 		if err != nil {
 			return err
 		}
-		err_rem := c.subscriptions.removeByChannelID(s.ChanID)
+		_, err_rem := c.subscriptions.removeBySocketChannelID(s.ChanID, socketId)
 		if err_rem != nil {
 			return err_rem
 		}
-		c.listener <- &s
+		c.recordSubscriptions(socketId)
+		c.publish(&s)
 	case "error":
 		er := ErrorEvent{}
 		err = json.Unmarshal(msg, &er)
 		if err != nil {
 			return err
 		}
-		c.listener <- &er
+		c.publish(&er)
+		if er.SubID != "" {
+			c.handleSubscriptionReject(socketId, &er)
+		}
+	case "pong":
+		p := PongEvent{}
+		err = json.Unmarshal(msg, &p)
+		if err != nil {
+			return err
+		}
+		// only pongs to pings sent by the user are published
+		if !c.handlePong(socketId, &p) {
+			c.publish(&p)
+		}
 	case "conf":
 		ec := ConfEvent{}
 		err = json.Unmarshal(msg, &ec)
 		if err != nil {
 			return err
 		}
-		c.listener <- &ec
+		// track the flags of the connection to parse appended fields
+		if socket, err_sock := c.socketById(socketId); err_sock == nil {
+			socket.conn.flags = ec.Flags
+		}
+		c.publish(&ec)
 	default:
 		c.log.Warningf("unknown event: %s", msg)
 	}
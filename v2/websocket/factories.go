@@ -9,6 +9,7 @@ import (
 	"github.com/vx416/bitfinex-api-go/pkg/models/book"
 	"github.com/vx416/bitfinex-api-go/pkg/models/candle"
 	"github.com/vx416/bitfinex-api-go/pkg/models/derivatives"
+	"github.com/vx416/bitfinex-api-go/pkg/models/status"
 	"github.com/vx416/bitfinex-api-go/pkg/models/ticker"
 	"github.com/vx416/bitfinex-api-go/pkg/models/trade"
 )
@@ -18,6 +19,12 @@ type messageFactory interface {
 	BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error)
 }
 
+// bulkMessageFactory is implemented by factories of channels whose updates
+// may be batched with the BULK_UPDATES conf flag.
+type bulkMessageFactory interface {
+	BuildBulk(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error)
+}
+
 type TickerFactory struct {
 	*subscriptions
 }
@@ -59,16 +66,20 @@ func (f *TradeFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw
 
 type BookFactory struct {
 	*subscriptions
-	orderbooks  map[string]*Orderbook
-	manageBooks bool
-	lock        sync.Mutex
+	orderbooks        map[string]*Orderbook
+	rawOrderbooks     map[string]*RawOrderbook
+	fundingOrderbooks map[string]*FundingOrderbook
+	manageBooks       bool
+	lock              sync.Mutex
 }
 
-func newBookFactory(subs *subscriptions, obs map[string]*Orderbook, manageBooks bool) *BookFactory {
+func newBookFactory(subs *subscriptions, obs map[string]*Orderbook, rawObs map[string]*RawOrderbook, fundingObs map[string]*FundingOrderbook, manageBooks bool) *BookFactory {
 	return &BookFactory{
-		subscriptions: subs,
-		orderbooks:    obs,
-		manageBooks:   manageBooks,
+		subscriptions:     subs,
+		orderbooks:        obs,
+		rawOrderbooks:     rawObs,
+		fundingOrderbooks: fundingObs,
+		manageBooks:       manageBooks,
 	}
 }
 
@@ -92,10 +103,24 @@ func (f *BookFactory) Build(sub *subscription, objType string, raw []interface{}
 	}
 
 	update, err := book.FromRaw(sub.Request.Symbol, sub.Request.Precision, raw, rawJSONNumbers[1])
-	if f.manageBooks {
+	if f.manageBooks && err == nil {
 		f.lock.Lock()
 		defer f.lock.Unlock()
-		if orderbook, ok := f.orderbooks[sub.Request.Symbol]; ok {
+		// updates still in flight for a book being resynced or moved to another
+		// socket must not touch the rebuilt book, checked under the book lock as
+		// the new snapshot is applied under it
+		if f.isStale(sub) {
+			return update, err
+		}
+		if book.IsRawBook(sub.Request.Precision) {
+			if orderbook, ok := f.rawOrderbooks[sub.Request.Symbol]; ok {
+				orderbook.UpdateWith(update)
+			}
+		} else if book.IsFundingBook(sub.Request.Symbol) {
+			if orderbook, ok := f.fundingOrderbooks[sub.Request.Symbol]; ok {
+				orderbook.UpdateWith(update)
+			}
+		} else if orderbook, ok := f.orderbooks[sub.Request.Symbol]; ok {
 			orderbook.UpdateWith(update)
 		}
 	}
@@ -103,6 +128,40 @@ func (f *BookFactory) Build(sub *subscription, objType string, raw []interface{}
 	return update, err
 }
 
+func (f *BookFactory) BuildBulk(sub *subscription, raw [][]interface{}, b []byte) (interface{}, error) {
+	rawJSONNumbers, err := ConvertBytesToJsonNumberArray(b)
+	if err != nil {
+		return nil, err
+	}
+
+	bulk, err := book.BulkUpdateFromRaw(sub.Request.Symbol, sub.Request.Precision, raw, rawJSONNumbers[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// apply the whole batch under a single book lock
+	if f.manageBooks {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if f.isStale(sub) {
+			return bulk, nil
+		}
+		if book.IsRawBook(sub.Request.Precision) {
+			if orderbook, ok := f.rawOrderbooks[sub.Request.Symbol]; ok {
+				orderbook.UpdateWithBulk(bulk.Updates)
+			}
+		} else if book.IsFundingBook(sub.Request.Symbol) {
+			if orderbook, ok := f.fundingOrderbooks[sub.Request.Symbol]; ok {
+				orderbook.UpdateWithBulk(bulk.Updates)
+			}
+		} else if orderbook, ok := f.orderbooks[sub.Request.Symbol]; ok {
+			orderbook.UpdateWithBulk(bulk.Updates)
+		}
+	}
+
+	return bulk, nil
+}
+
 func (f *BookFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, b []byte) (interface{}, error) {
 	rawJSONNumbers, err := ConvertBytesToJsonNumberArray(b)
 	if err != nil {
@@ -117,13 +176,24 @@ func (f *BookFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, b []
 	if f.manageBooks {
 		f.lock.Lock()
 		defer f.lock.Unlock()
-		// create new orderbook
-		f.orderbooks[sub.Request.Symbol] = &Orderbook{
-			symbol: sub.Request.Symbol,
-			bids:   make([]*book.Book, 0),
-			asks:   make([]*book.Book, 0),
+		// reuse existing books so references held by callers see the rebuilt book
+		symbol := sub.Request.Symbol
+		if book.IsRawBook(sub.Request.Precision) {
+			if _, ok := f.rawOrderbooks[symbol]; !ok {
+				f.rawOrderbooks[symbol] = newRawOrderbook(symbol)
+			}
+			f.rawOrderbooks[symbol].SetWithSnapshot(update)
+		} else if book.IsFundingBook(symbol) {
+			if _, ok := f.fundingOrderbooks[symbol]; !ok {
+				f.fundingOrderbooks[symbol] = newFundingOrderbook(symbol)
+			}
+			f.fundingOrderbooks[symbol].SetWithSnapshot(update)
+		} else {
+			if _, ok := f.orderbooks[symbol]; !ok {
+				f.orderbooks[symbol] = newOrderbook(symbol)
+			}
+			f.orderbooks[symbol].SetWithSnapshot(update)
 		}
-		f.orderbooks[sub.Request.Symbol].SetWithSnapshot(update)
 	}
 
 	return update, nil
@@ -167,7 +237,14 @@ func newStatsFactory(subs *subscriptions) *StatsFactory {
 	}
 }
 
+func isLiquidationKey(key string) bool {
+	return strings.HasPrefix(key, "liq:")
+}
+
 func (f *StatsFactory) Build(sub *subscription, objType string, raw []interface{}, raw_bytes []byte) (interface{}, error) {
+	if isLiquidationKey(sub.Request.Key) {
+		return status.LiqFromRaw(raw)
+	}
 	splits := strings.Split(sub.Request.Key, ":")
 	if len(splits) != 3 {
 		return nil, fmt.Errorf("unable to parse key to symbol %s", sub.Request.Key)
@@ -178,6 +255,17 @@ func (f *StatsFactory) Build(sub *subscription, objType string, raw []interface{
 }
 
 func (f *StatsFactory) BuildSnapshot(sub *subscription, raw [][]interface{}, raw_bytes []byte) (interface{}, error) {
-	// no snapshots
-	return nil, nil
+	if !isLiquidationKey(sub.Request.Key) {
+		// no snapshots
+		return nil, nil
+	}
+	// liquidation updates are wrapped in an array as well, only the first
+	// message of the subscription is a snapshot
+	if !sub.snapshot {
+		return status.LiqSnapshotFromRaw(raw)
+	}
+	if len(raw) == 1 {
+		return status.LiqFromRaw(raw[0])
+	}
+	return status.LiqUpdateFromRaw(raw)
 }
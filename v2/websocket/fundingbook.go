@@ -0,0 +1,229 @@
+package websocket
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// fundingBookSide holds the levels of one side of a funding book. Levels are
+// keyed by rate and period and ordered best rate first, then by period.
+type fundingBookSide struct {
+	desc   bool // bids are ordered highest rate first
+	levels []*book.Book
+}
+
+func newFundingBookSide(desc bool) *fundingBookSide {
+	return &fundingBookSide{desc: desc, levels: make([]*book.Book, 0)}
+}
+
+func (s *fundingBookSide) less(a, b *book.Book) bool {
+	if a.Rate != b.Rate {
+		if s.desc {
+			return a.Rate > b.Rate
+		}
+		return a.Rate < b.Rate
+	}
+	return a.Period < b.Period
+}
+
+func (s *fundingBookSide) search(b *book.Book) (int, bool) {
+	i := sort.Search(len(s.levels), func(i int) bool {
+		return !s.less(s.levels[i], b)
+	})
+	return i, i < len(s.levels) && s.levels[i].Rate == b.Rate && s.levels[i].Period == b.Period
+}
+
+func (s *fundingBookSide) set(b *book.Book) {
+	i, ok := s.search(b)
+	if ok {
+		s.levels[i] = b
+		return
+	}
+	s.levels = append(s.levels, nil)
+	copy(s.levels[i+1:], s.levels[i:])
+	s.levels[i] = b
+}
+
+func (s *fundingBookSide) remove(b *book.Book) {
+	i, ok := s.search(b)
+	if !ok {
+		return
+	}
+	copy(s.levels[i:], s.levels[i+1:])
+	s.levels[len(s.levels)-1] = nil
+	s.levels = s.levels[:len(s.levels)-1]
+}
+
+func (s *fundingBookSide) reset(levels []*book.Book) {
+	s.levels = levels
+	sort.SliceStable(s.levels, func(i, j int) bool {
+		return s.less(s.levels[i], s.levels[j])
+	})
+}
+
+// best returns the first level with a period within [minPeriod, maxPeriod].
+// A maxPeriod <= 0 means no upper bound.
+func (s *fundingBookSide) best(minPeriod, maxPeriod int64) (book.Book, bool) {
+	for _, l := range s.levels {
+		if l.Period < minPeriod || (maxPeriod > 0 && l.Period > maxPeriod) {
+			continue
+		}
+		return *l, true
+	}
+	return book.Book{}, false
+}
+
+// fundingLevel returns a copy of a funding book entry with its side derived
+// from the signed amount of the book model: offers to lend (asks) are positive,
+// requests to borrow (bids) negative. The copy holds the absolute amount, raw
+// entries without a rate and aggregated entries without a count are removals.
+func fundingLevel(b *book.Book, raw bool) *book.Book {
+	l := *b
+	l.Side = common.Bid
+	if b.Amount > 0 {
+		l.Side = common.Ask
+	}
+	l.Amount = math.Abs(b.Amount)
+	l.Action = book.BookEntry
+	if (raw && b.Rate <= 0) || (!raw && b.Count <= 0) {
+		l.Action = book.BookRemoveEntry
+	}
+	return &l
+}
+
+// jsNumber formats a number like the JavaScript number to string conversion
+// the bitfinex checksum is calculated with
+func jsNumber(f float64) string {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+		return mantissa + "e" + exp[:1] + strings.TrimLeft(exp[1:], "0")
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// FundingOrderbook is a locally managed funding book. Bids are requests to
+// borrow and asks are offers to lend, each level is identified by its rate
+// and period.
+type FundingOrderbook struct {
+	lock sync.RWMutex
+
+	symbol string
+	bids   *fundingBookSide
+	asks   *fundingBookSide
+}
+
+func newFundingOrderbook(symbol string) *FundingOrderbook {
+	return &FundingOrderbook{
+		symbol: symbol,
+		bids:   newFundingBookSide(true),
+		asks:   newFundingBookSide(false),
+	}
+}
+
+func (ob *FundingOrderbook) Symbol() string {
+	return ob.symbol
+}
+
+// Bids returns a dereferenced copy of the borrowing demand, highest rate first.
+func (ob *FundingOrderbook) Bids() []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return copyOrders(ob.bids.levels)
+}
+
+// Asks returns a dereferenced copy of the lending offers, lowest rate first.
+func (ob *FundingOrderbook) Asks() []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return copyOrders(ob.asks.levels)
+}
+
+// BestLendingRate returns the highest rate borrowers are bidding for a period
+// within [minPeriod, maxPeriod] days. A maxPeriod <= 0 means no upper bound.
+func (ob *FundingOrderbook) BestLendingRate(minPeriod, maxPeriod int64) (float64, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	l, ok := ob.bids.best(minPeriod, maxPeriod)
+	return l.Rate, ok
+}
+
+// BestBorrowingRate returns the lowest rate offered by lenders for a period
+// within [minPeriod, maxPeriod] days. A maxPeriod <= 0 means no upper bound.
+func (ob *FundingOrderbook) BestBorrowingRate(minPeriod, maxPeriod int64) (float64, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	l, ok := ob.asks.best(minPeriod, maxPeriod)
+	return l.Rate, ok
+}
+
+func (ob *FundingOrderbook) SetWithSnapshot(bs *book.Snapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	bids := make([]*book.Book, 0, len(bs.Snapshot))
+	asks := make([]*book.Book, 0, len(bs.Snapshot))
+	for _, entry := range bs.Snapshot {
+		level := fundingLevel(entry, false)
+		if level.Side == common.Bid {
+			bids = append(bids, level)
+		} else {
+			asks = append(asks, level)
+		}
+	}
+	ob.bids.reset(bids)
+	ob.asks.reset(asks)
+}
+
+func (ob *FundingOrderbook) UpdateWith(b *book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.update(b)
+}
+
+// UpdateWithBulk applies a batch of updates atomically.
+func (ob *FundingOrderbook) UpdateWithBulk(updates []*book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	for _, b := range updates {
+		ob.update(b)
+	}
+}
+
+func (ob *FundingOrderbook) update(entry *book.Book) {
+	b := fundingLevel(entry, false)
+	side := ob.asks
+	if b.Side == common.Bid {
+		side = ob.bids
+	}
+	if b.Action == book.BookRemoveEntry {
+		side.remove(b)
+		return
+	}
+	side.set(b)
+}
+
+// Checksum calculates the crc32 checksum of the book, using the rate in place
+// of the price.
+func (ob *FundingOrderbook) Checksum() uint32 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	buf := make([]byte, 0, checksumDepth*4*16)
+	for i := 0; i < checksumDepth; i++ {
+		if len(ob.bids.levels) > i {
+			buf = appendChecksumItem(buf, jsNumber(ob.bids.levels[i].Rate))
+			buf = appendChecksumItem(buf, ob.bids.levels[i].AmountJsNum.String())
+		}
+		if len(ob.asks.levels) > i {
+			buf = appendChecksumItem(buf, jsNumber(ob.asks.levels[i].Rate))
+			buf = appendChecksumItem(buf, ob.asks.levels[i].AmountJsNum.String())
+		}
+	}
+	return crc32.ChecksumIEEE(buf)
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+)
+
+func testFundingLevel(t *testing.T, precision, raw string) *book.Book {
+	nums, err := ConvertBytesToJsonNumberArray([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]interface{}, len(nums))
+	for i, n := range nums {
+		data[i], _ = n.(json.Number).Float64()
+	}
+	b, err := book.FromRaw("fUSD", precision, data, nums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFundingOrderbook(t *testing.T) {
+	ob := newFundingOrderbook("fUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testFundingLevel(t, "P0", `[0.0003,2,1,-1000]`),
+		testFundingLevel(t, "P0", `[0.0004,30,2,-500]`),
+		testFundingLevel(t, "P0", `[0.0003,7,1,-200]`),
+		testFundingLevel(t, "P0", `[0.00031,2,3,800]`),
+		testFundingLevel(t, "P0", `[0.00035,30,1,300]`),
+	}})
+
+	// offers to lend are asks, lowest rate first
+	asks := ob.Asks()
+	assert.Len(t, asks, 2)
+	assert.Equal(t, 0.00031, asks[0].Rate)
+
+	// levels are keyed by rate and period
+	ob.UpdateWith(testFundingLevel(t, "P0", `[0.0003,7,2,-700]`))
+	ob.UpdateWith(testFundingLevel(t, "P0", `[0.0004,30,0,-1]`))
+	bids := ob.Bids()
+	assert.Len(t, bids, 2)
+	assert.Equal(t, []int64{2, 7}, []int64{bids[0].Period, bids[1].Period})
+	assert.Equal(t, 700.0, bids[1].Amount)
+
+	rate, ok := ob.BestLendingRate(5, 30)
+	assert.True(t, ok)
+	assert.Equal(t, 0.0003, rate)
+	_, ok = ob.BestLendingRate(10, 0)
+	assert.False(t, ok)
+	rate, ok = ob.BestBorrowingRate(10, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0.00035, rate)
+
+	expected := crc32.ChecksumIEEE([]byte("0.0003:-1000:0.00031:800:0.0003:-700:0.00035:300"))
+	assert.Equal(t, expected, ob.Checksum())
+}
+
+func TestRawFundingOrderbookAggregated(t *testing.T) {
+	ob := newRawOrderbook("fUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testFundingLevel(t, "R0", `[1,2,0.0003,-100]`),
+		testFundingLevel(t, "R0", `[2,2,0.0003,-50]`),
+		testFundingLevel(t, "R0", `[3,2,0.0004,-10]`),
+		testFundingLevel(t, "R0", `[4,2,0.0005,25]`),
+	}})
+	ob.UpdateWith(testFundingLevel(t, "R0", `[3,2,0,-1]`))
+
+	bids := ob.Bids()
+	assert.Equal(t, []int64{1, 2}, []int64{bids[0].ID, bids[1].ID})
+
+	agg := ob.AggregatedFunding().Bids()
+	assert.Len(t, agg, 1)
+	assert.Equal(t, 150.0, agg[0].Amount)
+	assert.Equal(t, "-150", agg[0].AmountJsNum.String())
+	assert.Equal(t, int64(2), agg[0].Count)
+}
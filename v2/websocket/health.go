@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
+)
+
+// number of round trip times kept per connection for percentiles
+const pingWindow = 100
+
+// PingRequest asks the server for a pong reply carrying the same cid.
+type PingRequest struct {
+	Event string `json:"event"`
+	CID   int64  `json:"cid"`
+}
+
+// PongEvent answers a PingRequest. Pongs to the pings the client sends to
+// measure round trip times are not published.
+type PongEvent struct {
+	Ts  int64 `json:"ts"`
+	CID int64 `json:"cid"`
+}
+
+// PingStats summarizes the round trip times of the last ping requests of a
+// connection.
+type PingStats struct {
+	Samples  int
+	Last     time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	LastPong time.Time
+}
+
+// SocketHealth reports the state of a single connection.
+type SocketHealth struct {
+	SocketId      SocketId
+	Connected     bool
+	Authenticated bool
+	Ping          PingStats
+	LastMessage   time.Time
+	Reconnects    int
+	Subscriptions int
+}
+
+// Health is a snapshot of the state of all connections of a client.
+type Health struct {
+	Sockets       []SocketHealth
+	Reconnects    int
+	Subscriptions int
+}
+
+type pingTracker struct {
+	lock     sync.Mutex
+	cid      int64
+	pending  map[int64]time.Time // cid -> sent
+	rtts     []time.Duration
+	next     int
+	last     time.Duration
+	lastPong time.Time
+}
+
+func newPingTracker() *pingTracker {
+	return &pingTracker{pending: make(map[int64]time.Time)}
+}
+
+// start registers a new ping request and returns its cid
+func (p *pingTracker) start(now time.Time) int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cid++
+	p.pending[p.cid] = now
+	return p.cid
+}
+
+// pong records and returns the round trip time of the ping with the given cid
+func (p *pingTracker) pong(cid int64, now time.Time) (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	sent, ok := p.pending[cid]
+	if !ok {
+		return 0, false
+	}
+	delete(p.pending, cid)
+	rtt := now.Sub(sent)
+	if len(p.rtts) < pingWindow {
+		p.rtts = append(p.rtts, rtt)
+	} else {
+		p.rtts[p.next] = rtt
+		p.next = (p.next + 1) % pingWindow
+	}
+	p.last = rtt
+	p.lastPong = now
+	return rtt, true
+}
+
+// expired reports whether a ping has been waiting for its pong longer than timeout
+func (p *pingTracker) expired(now time.Time, timeout time.Duration) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, sent := range p.pending {
+		if now.Sub(sent) > timeout {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pingTracker) stats() PingStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s := PingStats{Samples: len(p.rtts), Last: p.last, LastPong: p.lastPong}
+	if len(p.rtts) == 0 {
+		return s
+	}
+	sorted := make([]time.Duration, len(p.rtts))
+	copy(sorted, p.rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	s.P50, s.P90, s.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	s.Max = sorted[len(sorted)-1]
+	return s
+}
+
+// touch records the time a message was received on the connection
+func (s *connState) touch(now time.Time) {
+	atomic.StoreInt64(&s.lastMessage, now.UnixNano())
+}
+
+func (s *connState) lastMessageTime() time.Time {
+	if ns := atomic.LoadInt64(&s.lastMessage); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// pingLoop sends a ping on every PingInterval until the connection is done and
+// restarts the connection if a pong is missing for longer than PongTimeout.
+func (c *Client) pingLoop(socket *Socket) {
+	if c.parameters.PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.parameters.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-socket.conn.done:
+			return
+		case now := <-ticker.C:
+			if socket.conn.pings.expired(now, c.parameters.PongTimeout) {
+				c.socketLog(socket.Id).Warningf("missed pong after %s", c.parameters.PongTimeout)
+				c.restartSocket(socket, fmt.Errorf("pong timeout"))
+				return
+			}
+			req := &PingRequest{Event: EventPing, CID: socket.conn.pings.start(now)}
+			ctx, cancel := context.WithTimeout(context.Background(), c.parameters.PingInterval)
+			if err := socket.Asynchronous.Send(ctx, req); err != nil {
+				c.socketLog(socket.Id).Warningf("could not send ping: %s", err.Error())
+			}
+			cancel()
+		}
+	}
+}
+
+// handlePong records the round trip of a ping sent by the client and reports
+// whether the pong answered one
+func (c *Client) handlePong(socketId SocketId, pong *PongEvent) bool {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return false
+	}
+	rtt, ok := socket.conn.pings.pong(pong.CID, time.Now())
+	if !ok {
+		c.socketLog(socketId).Debugf("unexpected pong cid %d", pong.CID)
+		return false
+	}
+	c.metrics.Observe(metrics.WsPingRTT, socketLabels(socketId), rtt.Seconds())
+	return true
+}
+
+// Health returns the ping round trip times, last message time, reconnect count
+// and subscription count of every connection.
+func (c *Client) Health() Health {
+	h := Health{Sockets: make([]SocketHealth, 0)}
+	c.mtx.RLock()
+	for _, socket := range c.sockets {
+		h.Sockets = append(h.Sockets, SocketHealth{
+			SocketId:      socket.Id,
+			Connected:     socket.IsConnected,
+			Authenticated: socket.IsAuthenticated,
+			Ping:          socket.conn.pings.stats(),
+			LastMessage:   socket.conn.lastMessageTime(),
+			Reconnects:    socket.conn.reconnects,
+		})
+	}
+	c.mtx.RUnlock()
+	sort.Slice(h.Sockets, func(i, j int) bool { return h.Sockets[i].SocketId < h.Sockets[j].SocketId })
+
+	for i := range h.Sockets {
+		sh := &h.Sockets[i]
+		if set, err := c.subscriptions.lookupBySocketId(sh.SocketId); err == nil {
+			sh.Subscriptions = set.Len()
+		}
+		h.Reconnects += sh.Reconnects
+		h.Subscriptions += sh.Subscriptions
+	}
+	return h
+}
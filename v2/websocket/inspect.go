@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// SubscriptionInfo describes a subscription tracked by the client.
+type SubscriptionInfo struct {
+	SubID         string
+	SocketId      SocketId
+	ChanID        int64 // -1 while pending
+	Pending       bool  // not yet acknowledged by the server
+	Request       *SubscriptionRequest
+	LastHeartbeat time.Time // last message or heartbeat, zero if none received
+	Messages      int64     // messages received on the channel, heartbeats included
+}
+
+// SubscriptionFilter selects subscriptions by channel and symbol, empty fields
+// match any value.
+type SubscriptionFilter struct {
+	Channel string
+	Symbol  string
+}
+
+// Matches reports whether the request is selected by the filter.
+func (f SubscriptionFilter) Matches(req *SubscriptionRequest) bool {
+	if f.Channel != "" && f.Channel != req.Channel {
+		return false
+	}
+	return f.Symbol == "" || f.Symbol == req.Symbol
+}
+
+// SubscriptionActivated is published after the SubscribeEvent acknowledging a
+// subscription, messages of the channel follow.
+type SubscriptionActivated struct {
+	SubID    string
+	SocketId SocketId
+	ChanID   int64
+	Request  *SubscriptionRequest
+}
+
+// SubscriptionRejected is published after the ErrorEvent rejecting a pending
+// subscription, the subscription is no longer tracked.
+type SubscriptionRejected struct {
+	SubID    string
+	SocketId SocketId
+	Request  *SubscriptionRequest
+	Code     int // code of the ErrorEvent
+	Message  string
+}
+
+// SubscriptionDropped is published when no heartbeat arrived for a subscription
+// within the HeartbeatTimeout, the connection of the subscription is restarted.
+type SubscriptionDropped struct {
+	SubID    string
+	SocketId SocketId
+	ChanID   int64
+	Request  *SubscriptionRequest
+	Error    error
+}
+
+// info returns a snapshot of all tracked subscriptions
+func (s *subscriptions) info() []SubscriptionInfo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	infos := make([]SubscriptionInfo, 0, len(s.subsBySubID))
+	for _, sub := range s.subsBySubID {
+		infos = append(infos, SubscriptionInfo{
+			SubID:         sub.SubID(),
+			SocketId:      sub.SocketId,
+			ChanID:        sub.ChanID,
+			Pending:       sub.pending,
+			Request:       sub.Request,
+			LastHeartbeat: sub.lastHeartbeat,
+			Messages:      sub.messages,
+		})
+	}
+	return infos
+}
+
+// Subscriptions returns the pending and active subscriptions of all
+// connections, ordered by socket and subscription id.
+func (c *Client) Subscriptions() []SubscriptionInfo {
+	infos := c.subscriptions.info()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].SocketId != infos[j].SocketId {
+			return infos[i].SocketId < infos[j].SocketId
+		}
+		return infos[i].SubID < infos[j].SubID
+	})
+	return infos
+}
+
+// UnsubscribeBy unsubscribes from all active public subscriptions selected by
+// the filter and returns their ids. Subscriptions are removed once the server
+// acknowledged the unsubscribe, pending subscriptions are skipped.
+func (c *Client) UnsubscribeBy(ctx context.Context, filter SubscriptionFilter) ([]string, error) {
+	subs := c.subscriptions.lookupByRequest(func(req *SubscriptionRequest) bool {
+		return isPublic(req) && filter.Matches(req)
+	})
+	sort.Sort(SubscriptionSet(subs))
+	ids := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		if c.subscriptions.isPending(sub) {
+			continue
+		}
+		if err := c.Unsubscribe(ctx, sub.SubID()); err != nil {
+			return ids, err
+		}
+		ids = append(ids, sub.SubID())
+	}
+	return ids, nil
+}
+
+// UnsubscribeAll unsubscribes from all active public subscriptions and returns
+// their ids.
+func (c *Client) UnsubscribeAll(ctx context.Context) ([]string, error) {
+	return c.UnsubscribeBy(ctx, SubscriptionFilter{})
+}
+
+func (s *subscriptions) isPending(sub *subscription) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return sub.pending
+}
+
+// handleSubscriptionReject stops tracking a pending subscription rejected by
+// the server
+func (c *Client) handleSubscriptionReject(socketId SocketId, er *ErrorEvent) {
+	sub, err := c.subscriptions.lookupBySubscriptionID(er.SubID)
+	if err != nil || !c.subscriptions.isPending(sub) {
+		return
+	}
+	if err := c.subscriptions.removeBySubscriptionID(er.SubID); err != nil {
+		return
+	}
+	c.recordSubscriptions(socketId)
+	c.subLog(sub).Warningf("subscription %s rejected: %s (%d)", sub.Request.String(), er.Message, er.Code)
+	c.publish(&SubscriptionRejected{
+		SubID:    er.SubID,
+		SocketId: socketId,
+		Request:  sub.Request,
+		Code:     er.Code,
+		Message:  er.Message,
+	})
+}
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("websocket client closed")
+
+// Run connects the client and blocks until the context is done or the client
+// is closed. Once the context is done Run unsubscribes from all public channels,
+// waiting at most ShutdownTimeout for the acknowledgements, and closes the
+// client. Messages published during shutdown are dropped unless the listener
+// channel is read, the listener channel is closed and no goroutine of the
+// client is left running when Run returns.
+func (c *Client) Run(ctx context.Context) error {
+	if err := c.Connect(); err != nil {
+		c.Close()
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		c.beginShutdown()
+		c.unsubscribeAndWait()
+	case <-c.shutdown:
+	}
+	c.Close()
+	return nil
+}
+
+// Close the websocket client which will cause for all
+// active sockets to be exited and the listener channel
+// to be closed. Close waits for all goroutines of the
+// client and is safe to call more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.beginShutdown()
+		c.calc.stop()
+		c.stopBookWatchers()
+		c.mtx.Lock()
+		sockets := make([]*Socket, 0, len(c.sockets))
+		for _, socket := range c.sockets {
+			if socket.IsConnected {
+				socket.IsConnected = false
+				sockets = append(sockets, socket)
+			}
+		}
+		c.mtx.Unlock()
+		var wg sync.WaitGroup
+		for _, socket := range sockets {
+			wg.Add(1)
+			go func(s *Socket) {
+				c.closeAsyncAndWait(s, c.parameters.ShutdownTimeout)
+				wg.Done()
+			}(socket)
+		}
+		wg.Wait()
+		c.waitGroup.Wait()
+		c.subscriptions.Close()
+		c.listenerLock.Lock()
+		c.listenerClosed = true
+		close(c.listener)
+		c.listenerLock.Unlock()
+	})
+}
+
+// beginShutdown stops reconnects and new connections and unblocks publishers
+func (c *Client) beginShutdown() {
+	c.shutdownOnce.Do(func() {
+		c.mtx.Lock()
+		c.terminal = true
+		c.mtx.Unlock()
+		close(c.shutdown)
+	})
+}
+
+// unsubscribeAndWait unsubscribes from all public channels and waits for the
+// acknowledgements until the ShutdownTimeout
+func (c *Client) unsubscribeAndWait() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.parameters.ShutdownTimeout)
+	defer cancel()
+	ids, err := c.UnsubscribeAll(ctx)
+	if err != nil {
+		c.log.Warningf("could not unsubscribe: %s", err.Error())
+	}
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for _, id := range ids {
+		for {
+			if _, err := c.subscriptions.lookupBySubscriptionID(id); err != nil {
+				break
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				c.log.Warningf("unsubscribe not acknowledged within %s", c.parameters.ShutdownTimeout)
+				return
+			}
+		}
+	}
+}
+
+// publish delivers a message on the listener channel, messages are dropped
+// once the client shuts down and the listener is not read
+func (c *Client) publish(msg interface{}) {
+	c.listenerLock.RLock()
+	defer c.listenerLock.RUnlock()
+	if c.listenerClosed {
+		return
+	}
+	select {
+	case c.listener <- msg:
+	case <-c.shutdown:
+	}
+}
+
+// spawn runs fn in a goroutine awaited by Close, fn is not run once the client
+// shuts down
+func (c *Client) spawn(fn func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.spawnLocked(fn)
+}
+
+// spawnLocked is spawn with the client mutex held
+func (c *Client) spawnLocked(fn func()) {
+	if c.terminal {
+		return
+	}
+	c.waitGroup.Add(1)
+	go func() {
+		defer c.waitGroup.Done()
+		fn()
+	}()
+}
+
+// sleep waits for the given duration, returns false if the client shuts down
+// first
+func (c *Client) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.shutdown:
+		return false
+	}
+}
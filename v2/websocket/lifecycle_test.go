@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientGoroutines returns the stacks of running goroutines of the client and
+// its transports by goroutine header
+func clientGoroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if !strings.Contains(stack, "bitfinex-api-go/v2/websocket.(*") {
+			continue
+		}
+		header := stack[:strings.Index(stack, " [")]
+		stacks[header] = stack
+	}
+	return stacks
+}
+
+// checkNoLeaks fails if goroutines of the client started after before are
+// still running after a short grace period
+func checkNoLeaks(t *testing.T, before map[string]string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		leaked := make([]string, 0)
+		for header, stack := range clientGoroutines() {
+			if _, ok := before[header]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked goroutines:\n%s", strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 2)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	before := clientGoroutines()
+	srv := tickerServer(t)
+	defer srv.Close()
+
+	var recording bytes.Buffer
+	p := NewDefaultParameters()
+	p.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	p.ShutdownTimeout = time.Second
+	p.Recorder = NewRecorder(&recording)
+	ws := NewWithParams(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.Run(ctx)
+	}()
+	nextEvent(t, ws.Listen(), func(ev interface{}) bool {
+		_, ok := ev.(*InfoEvent)
+		return ok
+	})
+
+	// the listener is not read anymore, publishing the acknowledgement blocks
+	_, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	require.Nil(t, err)
+	waitFor(t, func() bool {
+		subs := ws.Subscriptions()
+		return len(subs) == 1 && !subs[0].Pending
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// the listener is closed after draining
+	for range ws.Listen() {
+	}
+	// closing again is a no-op
+	ws.Close()
+	assert.False(t, ws.IsConnected())
+
+	frames, err := ReadFrames(&recording)
+	require.Nil(t, err)
+	unsubscribed := false
+	for _, f := range frames {
+		if f.Direction == FrameIn && strings.Contains(f.Data, `"unsubscribed"`) {
+			unsubscribed = true
+		}
+	}
+	assert.True(t, unsubscribed, "expected unsubscribe to be acknowledged")
+
+	checkNoLeaks(t, before)
+}
+
+func TestCloseWithoutReader(t *testing.T) {
+	before := clientGoroutines()
+	srv := tickerServer(t)
+	defer srv.Close()
+
+	p := NewDefaultParameters()
+	p.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	p.ShutdownTimeout = time.Second
+	ws := NewWithParams(p)
+	require.Nil(t, ws.Connect())
+
+	// the info event is never read
+	_, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	require.Nil(t, err)
+	time.Sleep(time.Millisecond * 50)
+
+	closed := make(chan struct{})
+	go func() {
+		ws.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("Close blocked on the listener")
+	}
+	checkNoLeaks(t, before)
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MaintenanceStarted is published when the platform enters maintenance, order
+// submission fails with ErrMaintenance until MaintenanceEnded.
+type MaintenanceStarted struct {
+	SocketId SocketId
+	Time     time.Time
+}
+
+// MaintenanceEnded is published when the platform leaves maintenance, public
+// channels of the connection are resubscribed.
+type MaintenanceEnded struct {
+	SocketId SocketId
+	Time     time.Time
+}
+
+// InMaintenance reports whether the platform announced a maintenance that has
+// not ended yet.
+func (c *Client) InMaintenance() bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.maintenance
+}
+
+// checkMaintenance rejects order requests during maintenance
+func (c *Client) checkMaintenance() error {
+	if c.InMaintenance() {
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// hasPlatformStatus reports whether an info event carries the platform status,
+// which is missing from the info events of some servers
+func hasPlatformStatus(msg []byte) bool {
+	var info struct {
+		Platform *PlatformInfo `json:"platform"`
+	}
+	return json.Unmarshal(msg, &info) == nil && info.Platform != nil
+}
+
+// handlePlatformStatus applies the platform status of the info event a new
+// connection starts with. Maintenance starting or ending while a connection
+// was down is not announced to it by 20060 and 20061 info codes.
+func (c *Client) handlePlatformStatus(socketId SocketId, info *InfoEvent, msg []byte) {
+	if !hasPlatformStatus(msg) {
+		return
+	}
+	maintenance := info.Platform.Status != PlatformOperative
+	c.mtx.Lock()
+	changed := c.maintenance != maintenance
+	c.maintenance = maintenance
+	c.mtx.Unlock()
+	switch {
+	case changed && maintenance:
+		c.socketLog(socketId).Infof("connected during maintenance")
+		c.publish(&MaintenanceStarted{SocketId: socketId, Time: time.Now()})
+	case changed:
+		c.socketLog(socketId).Infof("maintenance ended while reconnecting")
+		c.publish(&MaintenanceEnded{SocketId: socketId, Time: time.Now()})
+	}
+}
+
+// handleInfoCode acts on the info codes sent by the platform. Once maintenance
+// ends the public channels are resubscribed. The authenticated channel is bound
+// to the connection rather than subscribed, it stays authenticated and can't be
+// authenticated again without reconnecting.
+func (c *Client) handleInfoCode(socketId SocketId, info *InfoEvent) {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return
+	}
+	switch info.Code {
+	case InfoCodeServerRestart:
+		c.socketLog(socketId).Infof("server restart: %s", info.Msg)
+		c.restartSocket(socket, fmt.Errorf("server restart: %s", info.Msg))
+	case InfoCodeMaintenanceStart:
+		c.socketLog(socketId).Infof("entering maintenance: %s", info.Msg)
+		c.mtx.Lock()
+		c.maintenance = true
+		c.mtx.Unlock()
+		c.publish(&MaintenanceStarted{SocketId: socketId, Time: time.Now()})
+	case InfoCodeMaintenanceEnd:
+		c.socketLog(socketId).Infof("maintenance ended: %s", info.Msg)
+		c.mtx.Lock()
+		c.maintenance = false
+		c.mtx.Unlock()
+		c.publish(&MaintenanceEnded{SocketId: socketId, Time: time.Now()})
+		c.resubscribeSocket(socket)
+	}
+}
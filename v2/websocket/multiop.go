@@ -0,0 +1,350 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/vx416/bitfinex-api-go/pkg/convert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/notification"
+	"github.com/vx416/bitfinex-api-go/pkg/models/order"
+	"github.com/vx416/bitfinex-api-go/v2/rest"
+)
+
+// OrderMultiRequest submits several order operations at once, using the same
+// ops as rest.OrderService.OrderMultiOp: "on", "ou", "oc" and "oc_multi".
+type OrderMultiRequest struct {
+	Ops rest.OrderOps
+}
+
+// MarshalJSON converts the multi order request into the format required by the
+// bitfinex websocket service.
+func (mr *OrderMultiRequest) MarshalJSON() ([]byte, error) {
+	ops := make(rest.OrderOps, 0, len(mr.Ops))
+	for _, op := range mr.Ops {
+		if len(op) != 2 {
+			return nil, fmt.Errorf("invalid order op: %#v", op)
+		}
+		switch o := op[1].(type) {
+		case order.NewRequest:
+			op = []interface{}{op[0], o.EnrichedPayload()}
+		case *order.NewRequest:
+			op = []interface{}{op[0], o.EnrichedPayload()}
+		case order.UpdateRequest:
+			op = []interface{}{op[0], o.EnrichedPayload()}
+		case *order.UpdateRequest:
+			op = []interface{}{op[0], o.EnrichedPayload()}
+		}
+		ops = append(ops, op)
+	}
+	b, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"ox_multi\", null, %s]", string(b))), nil
+}
+
+// CancelMultiRequest cancels orders by IDs, group IDs, client IDs or all orders.
+type CancelMultiRequest rest.CancelOrderMultiRequest
+
+// MarshalJSON converts the cancel request into the format required by the
+// bitfinex websocket service.
+func (cr *CancelMultiRequest) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal((*rest.CancelOrderMultiRequest)(cr))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("[0, \"oc_multi\", null, %s]", string(b))), nil
+}
+
+// OrderOpResult is the outcome of a single operation of a multi order request,
+// correlated with the notification the server sent for it. Err is set when the
+// server rejected the operation.
+type OrderOpResult struct {
+	Index        int // position of the op in the request
+	Op           string
+	Notification *notification.Notification
+	Err          error
+}
+
+// OrderMultiOp tracks the results of a multi order request.
+type OrderMultiOp struct {
+	results chan *OrderOpResult
+	count   int
+	ops     *orderOps
+}
+
+// Results delivers the result of every op as its notification arrives.
+func (m *OrderMultiOp) Results() <-chan *OrderOpResult {
+	return m.results
+}
+
+// Wait blocks until all ops have a result and returns them in request order.
+// Ops without a result once the context is done are no longer tracked.
+func (m *OrderMultiOp) Wait(ctx context.Context) ([]*OrderOpResult, error) {
+	results := make([]*OrderOpResult, 0, m.count)
+	for len(results) < m.count {
+		select {
+		case r := <-m.results:
+			results = append(results, r)
+		case <-ctx.Done():
+			m.ops.untrack(m)
+			return results, ctx.Err()
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+	return results, nil
+}
+
+// pendingOrderOp is an op awaiting its notification
+type pendingOrderOp struct {
+	multi *OrderMultiOp
+	index int
+	op    string
+	ids   []int64 // order ids
+	cids  []int64 // client order ids
+	gids  []int64 // group ids
+	all   bool    // cancels all orders
+}
+
+// correlated reports whether the op carries identifiers to match its notification
+func (p *pendingOrderOp) correlated() bool {
+	return p.all || len(p.ids) > 0 || len(p.cids) > 0 || len(p.gids) > 0
+}
+
+// matches reports whether one of the notified orders is addressed by the op
+func (p *pendingOrderOp) matches(orders []*order.Order) bool {
+	for _, o := range orders {
+		if containsID(p.ids, o.ID) || containsID(p.cids, o.CID) || containsID(p.gids, o.GID) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []int64, id int64) bool {
+	if id == 0 {
+		return false
+	}
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// notifiedOrders returns the orders carried by an order notification
+func notifiedOrders(n *notification.Notification) []*order.Order {
+	switch info := n.NotifyInfo.(type) {
+	case order.New:
+		o := order.Order(info)
+		return []*order.Order{&o}
+	case order.Update:
+		o := order.Order(info)
+		return []*order.Order{&o}
+	case order.Cancel:
+		o := order.Order(info)
+		return []*order.Order{&o}
+	case *order.Snapshot:
+		return info.Snapshot
+	case []interface{}:
+		// oc_multi notifications list the cancelled orders
+		orders := make([]*order.Order, 0, len(info))
+		for _, raw := range info {
+			if arr, ok := raw.([]interface{}); ok {
+				if o, err := order.FromRaw(arr); err == nil {
+					orders = append(orders, o)
+				}
+			}
+		}
+		return orders
+	}
+	return nil
+}
+
+type orderOps struct {
+	lock    sync.Mutex
+	pending []*pendingOrderOp
+}
+
+func (t *orderOps) track(ops []*pendingOrderOp) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending = append(t.pending, ops...)
+}
+
+func (t *orderOps) untrack(multi *OrderMultiOp) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	pending := t.pending[:0]
+	for _, p := range t.pending {
+		if p.multi != multi {
+			pending = append(pending, p)
+		}
+	}
+	t.pending = pending
+}
+
+// resolve hands a notification to the oldest pending op addressing one of its
+// orders by id, client id or group id. Cancel all ops take the notifications of
+// their type which no other op addresses.
+func (t *orderOps) resolve(obj interface{}) {
+	n, ok := obj.(*notification.Notification)
+	if !ok {
+		return
+	}
+	orders := notifiedOrders(n)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	match := -1
+	for i, p := range t.pending {
+		if n.Type != p.op+"-req" {
+			continue
+		}
+		if p.matches(orders) {
+			match = i
+			break
+		}
+		if p.all && match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return
+	}
+	p := t.pending[match]
+	t.pending = append(t.pending[:match], t.pending[match+1:]...)
+	res := &OrderOpResult{Index: p.index, Op: p.op, Notification: n}
+	if n.Status == "ERROR" || n.Status == "FAILURE" {
+		res.Err = fmt.Errorf("%s %s: %s", p.op, n.Status, n.Text)
+	}
+	p.multi.results <- res
+}
+
+// pendingOp extracts the identifiers used to correlate an op with its notification
+func pendingOp(multi *OrderMultiOp, index int, op []interface{}) (*pendingOrderOp, error) {
+	if len(op) != 2 {
+		return nil, fmt.Errorf("invalid order op: %#v", op)
+	}
+	name, ok := op[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid order op type: %#v", op[0])
+	}
+	p := &pendingOrderOp{multi: multi, index: index, op: name}
+	switch o := op[1].(type) {
+	case order.NewRequest:
+		p.addNew(o.CID, o.GID)
+	case *order.NewRequest:
+		p.addNew(o.CID, o.GID)
+	case order.UpdateRequest:
+		p.ids = nonZero(o.ID)
+	case *order.UpdateRequest:
+		p.ids = nonZero(o.ID)
+	case order.CancelRequest:
+		p.ids, p.cids = nonZero(o.ID), nonZero(o.CID)
+	case *order.CancelRequest:
+		p.ids, p.cids = nonZero(o.ID), nonZero(o.CID)
+	case rest.CancelOrderMultiRequest:
+		p.addCancelMulti(o)
+	case *rest.CancelOrderMultiRequest:
+		p.addCancelMulti(*o)
+	case map[string]int:
+		p.ids = nonZero(int64(o["id"]))
+	case map[string]int64:
+		p.ids = nonZero(o["id"])
+	}
+	if !p.correlated() {
+		return nil, fmt.Errorf("order op %d has no id, cid or gid to correlate its notification: %#v", index, op)
+	}
+	return p, nil
+}
+
+// addNew correlates a new order by client id, or by group id without one
+func (p *pendingOrderOp) addNew(cid, gid int64) {
+	if cid != 0 {
+		p.cids = []int64{cid}
+		return
+	}
+	p.gids = nonZero(gid)
+}
+
+func (p *pendingOrderOp) addCancelMulti(req rest.CancelOrderMultiRequest) {
+	p.all = req.All == 1
+	for _, id := range req.OrderIDs {
+		p.ids = append(p.ids, int64(id))
+	}
+	for _, gid := range req.GroupOrderIDs {
+		p.gids = append(p.gids, int64(gid))
+	}
+	for _, cid := range req.ClientOrderIDs {
+		if len(cid) > 0 {
+			p.cids = append(p.cids, convert.I64ValOrZero(cid[0]))
+		}
+	}
+}
+
+func nonZero(id int64) []int64 {
+	if id == 0 {
+		return nil
+	}
+	return []int64{id}
+}
+
+// SubmitOrderMulti submits several order operations in a single ox_multi
+// request. The returned OrderMultiOp delivers the result of each op as its
+// notification arrives.
+func (c *Client) SubmitOrderMulti(ctx context.Context, ops rest.OrderOps) (*OrderMultiOp, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no order ops given")
+	}
+	if err := c.checkMaintenance(); err != nil {
+		return nil, err
+	}
+	socket, err := c.GetAuthenticatedSocket()
+	if err != nil {
+		return nil, err
+	}
+	multi := &OrderMultiOp{results: make(chan *OrderOpResult, len(ops)), count: len(ops), ops: c.orderOps}
+	pending := make([]*pendingOrderOp, 0, len(ops))
+	for i, op := range ops {
+		p, err := pendingOp(multi, i, op)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	c.orderOps.track(pending)
+	if err := socket.Asynchronous.Send(ctx, &OrderMultiRequest{Ops: ops}); err != nil {
+		c.orderOps.untrack(multi)
+		return nil, err
+	}
+	return multi, nil
+}
+
+// CancelMulti cancels orders by IDs, group IDs, client IDs or all orders in a
+// single oc_multi request. The returned OrderMultiOp delivers one result.
+func (c *Client) CancelMulti(ctx context.Context, req rest.CancelOrderMultiRequest) (*OrderMultiOp, error) {
+	if err := c.checkMaintenance(); err != nil {
+		return nil, err
+	}
+	socket, err := c.GetAuthenticatedSocket()
+	if err != nil {
+		return nil, err
+	}
+	multi := &OrderMultiOp{results: make(chan *OrderOpResult, 1), count: 1, ops: c.orderOps}
+	p := &pendingOrderOp{multi: multi, op: "oc_multi"}
+	p.addCancelMulti(req)
+	if !p.correlated() {
+		return nil, fmt.Errorf("no orders to cancel given")
+	}
+	c.orderOps.track([]*pendingOrderOp{p})
+	cmr := CancelMultiRequest(req)
+	if err := socket.Asynchronous.Send(ctx, &cmr); err != nil {
+		c.orderOps.untrack(multi)
+		return nil, err
+	}
+	return multi, nil
+}
@@ -2,122 +2,346 @@ package websocket
 
 import (
 	"hash/crc32"
-	"sort"
-	"strings"
 	"sync"
 
 	"github.com/vx416/bitfinex-api-go/pkg/models/book"
 	"github.com/vx416/bitfinex-api-go/pkg/models/common"
 )
 
+// number of levels per side included in the bitfinex book checksum
+const checksumDepth = 25
+
+// maximum height of the skip list of a book side, each level holds a quarter
+// of the nodes of the level below
+const (
+	maxBookHeight = 16
+	bookBranching = 4
+)
+
+// bookLevel is a node of the skip list of a book side
+type bookLevel struct {
+	book *book.Book
+	next []*bookLevel
+}
+
+// bookSide holds the price levels of one side of the book in a skip list
+// ordered best price first and indexed by price. Updates to existing levels are
+// O(1), inserts and removals O(log n).
+type bookSide struct {
+	desc   bool // bids are ordered highest price first
+	head   *bookLevel
+	height int
+	index  map[float64]*bookLevel
+	seed   uint64 // xorshift state for the node heights
+}
+
+func newBookSide(desc bool) *bookSide {
+	s := &bookSide{desc: desc, seed: 0x9e3779b97f4a7c15}
+	s.clear()
+	return s
+}
+
+func (s *bookSide) clear() {
+	s.head = &bookLevel{next: make([]*bookLevel, maxBookHeight)}
+	s.height = 1
+	s.index = make(map[float64]*bookLevel, checksumDepth*2)
+}
+
+// before reports whether price a is ordered before price b on this side
+func (s *bookSide) before(a, b float64) bool {
+	if s.desc {
+		return a > b
+	}
+	return a < b
+}
+
+func (s *bookSide) randomHeight() int {
+	h := 1
+	for h < maxBookHeight {
+		s.seed ^= s.seed << 13
+		s.seed ^= s.seed >> 7
+		s.seed ^= s.seed << 17
+		if s.seed%bookBranching != 0 {
+			break
+		}
+		h++
+	}
+	return h
+}
+
+// predecessors fills path with the last node before price on every height
+func (s *bookSide) predecessors(price float64, path *[maxBookHeight]*bookLevel) {
+	x := s.head
+	for h := s.height - 1; h >= 0; h-- {
+		for x.next[h] != nil && s.before(x.next[h].book.Price, price) {
+			x = x.next[h]
+		}
+		path[h] = x
+	}
+}
+
+func (s *bookSide) set(b *book.Book) {
+	if l, ok := s.index[b.Price]; ok {
+		l.book = b
+		return
+	}
+	var path [maxBookHeight]*bookLevel
+	s.predecessors(b.Price, &path)
+	height := s.randomHeight()
+	for ; s.height < height; s.height++ {
+		path[s.height] = s.head
+	}
+	l := &bookLevel{book: b, next: make([]*bookLevel, height)}
+	for h := 0; h < height; h++ {
+		l.next[h] = path[h].next[h]
+		path[h].next[h] = l
+	}
+	s.index[b.Price] = l
+}
+
+func (s *bookSide) remove(price float64) {
+	l, ok := s.index[price]
+	if !ok {
+		return
+	}
+	var path [maxBookHeight]*bookLevel
+	s.predecessors(price, &path)
+	for h := range l.next {
+		path[h].next[h] = l.next[h]
+	}
+	for s.height > 1 && s.head.next[s.height-1] == nil {
+		s.height--
+	}
+	delete(s.index, price)
+}
+
+func (s *bookSide) reset(levels []*book.Book) {
+	s.clear()
+	for _, b := range levels {
+		s.set(b)
+	}
+}
+
+func (s *bookSide) len() int {
+	return len(s.index)
+}
+
+// best returns the level with the best price
+func (s *bookSide) best() (*book.Book, bool) {
+	if first := s.head.next[0]; first != nil {
+		return first.book, true
+	}
+	return nil, false
+}
+
+// eachLevel calls fn for the n best levels, or all levels if n <= 0, until fn
+// returns false
+func (s *bookSide) eachLevel(n int, fn func(*book.Book) bool) {
+	i := 0
+	for l := s.head.next[0]; l != nil && (n <= 0 || i < n); l = l.next[0] {
+		if !fn(l.book) {
+			return
+		}
+		i++
+	}
+}
+
+// top returns the n best levels, or all levels if n <= 0
+func (s *bookSide) top(n int) []*book.Book {
+	if n <= 0 || n > s.len() {
+		n = s.len()
+	}
+	levels := make([]*book.Book, 0, n)
+	s.eachLevel(n, func(b *book.Book) bool {
+		levels = append(levels, b)
+		return true
+	})
+	return levels
+}
+
+// copy returns dereferenced copies of at most n levels, or all levels if n <= 0
+func (s *bookSide) copy(n int) []book.Book {
+	if n <= 0 || n > s.len() {
+		n = s.len()
+	}
+	cpy := make([]book.Book, 0, n)
+	s.eachLevel(n, func(b *book.Book) bool {
+		cpy = append(cpy, *b)
+		return true
+	})
+	return cpy
+}
+
+func (s *bookSide) each(n int, fn func(book.Book) bool) {
+	s.eachLevel(n, func(b *book.Book) bool {
+		return fn(*b)
+	})
+}
+
 type Orderbook struct {
 	lock sync.RWMutex
 
 	symbol string
-	bids   []*book.Book
-	asks   []*book.Book
+	bids   *bookSide
+	asks   *bookSide
 }
 
-// return a dereferenced copy of an orderbook side. This is so consumers can access
-// the book but not change the values that are used to generate the crc32 checksum
-func (ob *Orderbook) copySide(side []*book.Book) []book.Book {
-	var cpy []book.Book
-	for i := 0; i < len(side); i++ {
-		cpy = append(cpy, *side[i])
+func newOrderbook(symbol string) *Orderbook {
+	return &Orderbook{
+		symbol: symbol,
+		bids:   newBookSide(true),
+		asks:   newBookSide(false),
 	}
-	return cpy
 }
 
 func (ob *Orderbook) Symbol() string {
 	return ob.symbol
 }
 
+// Asks returns a dereferenced copy of the ask side. This is so consumers can access
+// the book but not change the values that are used to generate the crc32 checksum
 func (ob *Orderbook) Asks() []book.Book {
 	ob.lock.RLock()
 	defer ob.lock.RUnlock()
-	return ob.copySide(ob.asks)
+	return ob.asks.copy(0)
 }
 
+// Bids returns a dereferenced copy of the bid side.
 func (ob *Orderbook) Bids() []book.Book {
 	ob.lock.RLock()
 	defer ob.lock.RUnlock()
-	return ob.copySide(ob.bids)
+	return ob.bids.copy(0)
+}
+
+// TopAsks returns a copy of the n best ask levels.
+func (ob *Orderbook) TopAsks(n int) []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.asks.copy(n)
+}
+
+// TopBids returns a copy of the n best bid levels.
+func (ob *Orderbook) TopBids(n int) []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.bids.copy(n)
+}
+
+// RangeAsks calls fn for the n best ask levels (all levels if n <= 0), best
+// price first, without allocating a copy of the side. Iteration stops when fn
+// returns false. fn is called under the book's read lock and must not call
+// back into the Orderbook.
+func (ob *Orderbook) RangeAsks(n int, fn func(book.Book) bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	ob.asks.each(n, fn)
+}
+
+// RangeBids calls fn for the n best bid levels, see RangeAsks.
+func (ob *Orderbook) RangeBids(n int, fn func(book.Book) bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	ob.bids.each(n, fn)
+}
+
+// BestAsk returns the lowest ask level.
+func (ob *Orderbook) BestAsk() (book.Book, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if best, ok := ob.asks.best(); ok {
+		return *best, true
+	}
+	return book.Book{}, false
+}
+
+// BestBid returns the highest bid level.
+func (ob *Orderbook) BestBid() (book.Book, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if best, ok := ob.bids.best(); ok {
+		return *best, true
+	}
+	return book.Book{}, false
+}
+
+// Len returns the number of bid and ask levels in the book.
+func (ob *Orderbook) Len() (bids int, asks int) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.bids.len(), ob.asks.len()
 }
 
 func (ob *Orderbook) SetWithSnapshot(bs *book.Snapshot) {
 	ob.lock.Lock()
 	defer ob.lock.Unlock()
 
-	ob.bids = make([]*book.Book, 0)
-	ob.asks = make([]*book.Book, 0)
+	bids := make([]*book.Book, 0, len(bs.Snapshot))
+	asks := make([]*book.Book, 0, len(bs.Snapshot))
 	for _, order := range bs.Snapshot {
 		if order.Side == common.Bid {
-			ob.bids = append(ob.bids, order)
+			bids = append(bids, order)
 		} else {
-			ob.asks = append(ob.asks, order)
+			asks = append(asks, order)
 		}
 	}
+	ob.bids.reset(bids)
+	ob.asks.reset(asks)
 }
 
 func (ob *Orderbook) UpdateWith(b *book.Book) {
 	ob.lock.Lock()
 	defer ob.lock.Unlock()
+	ob.update(b)
+}
 
-	side := &ob.asks
-	if b.Side == common.Bid {
-		side = &ob.bids
+// UpdateWithBulk applies a batch of updates atomically.
+func (ob *Orderbook) UpdateWithBulk(updates []*book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	for _, b := range updates {
+		ob.update(b)
 	}
+}
 
-	// check if first in book
-	if len(*side) == 0 {
-		*side = append(*side, b)
-		return
+func (ob *Orderbook) update(b *book.Book) {
+	side := ob.asks
+	if b.Side == common.Bid {
+		side = ob.bids
 	}
-
-	// match price level
-	for index, sOrder := range *side {
-		if sOrder.Price == b.Price {
-			if index+1 > len(*(side)) {
-				return
-			}
-			if b.Count <= 0 {
-				// delete if count is equal to zero
-				*side = append((*side)[:index], (*side)[index+1:]...)
-				return
-			}
-			// remove now and we will add in the code below
-			*side = append((*side)[:index], (*side)[index+1:]...)
-		}
+	if b.Count <= 0 {
+		// delete if count is equal to zero
+		side.remove(b.Price)
+		return
 	}
-	*side = append(*side, b)
-	// add to the orderbook and sort lowest to highest
-	sort.Slice(*side, func(i, j int) bool {
-		if i >= len(*(side)) || j >= len(*(side)) {
-			return false
-		}
-		if b.Side == common.Ask {
-			return (*side)[i].Price < (*side)[j].Price
-		}
-		return (*side)[i].Price > (*side)[j].Price
-	})
+	side.set(b)
 }
 
 func (ob *Orderbook) Checksum() uint32 {
-	ob.lock.Lock()
-	defer ob.lock.Unlock()
-	var checksumItems []string
-	for i := 0; i < 25; i++ {
-		if len(ob.bids) > i {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	buf := make([]byte, 0, checksumDepth*4*16)
+	bids := ob.bids.head.next[0]
+	asks := ob.asks.head.next[0]
+	for i := 0; i < checksumDepth; i++ {
+		if bids != nil {
 			// append bid
-			checksumItems = append(checksumItems, (ob.bids)[i].PriceJsNum.String())
-			checksumItems = append(checksumItems, (ob.bids)[i].AmountJsNum.String())
+			buf = appendChecksumItem(buf, bids.book.PriceJsNum.String())
+			buf = appendChecksumItem(buf, bids.book.AmountJsNum.String())
+			bids = bids.next[0]
 		}
-		if len(ob.asks) > i {
+		if asks != nil {
 			// append ask
-			checksumItems = append(checksumItems, (ob.asks)[i].PriceJsNum.String())
-			checksumItems = append(checksumItems, (ob.asks)[i].AmountJsNum.String())
+			buf = appendChecksumItem(buf, asks.book.PriceJsNum.String())
+			buf = appendChecksumItem(buf, asks.book.AmountJsNum.String())
+			asks = asks.next[0]
 		}
 	}
-	checksumStrings := strings.Join(checksumItems, ":")
-	return crc32.ChecksumIEEE([]byte(checksumStrings))
+	return crc32.ChecksumIEEE(buf)
+}
+
+func appendChecksumItem(buf []byte, item string) []byte {
+	if len(buf) > 0 {
+		buf = append(buf, ':')
+	}
+	return append(buf, item...)
 }
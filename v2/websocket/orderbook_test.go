@@ -0,0 +1,289 @@
+package websocket
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// legacyOrderbook is the previous linear scan & sort implementation, kept to
+// verify and benchmark the current Orderbook against.
+type legacyOrderbook struct {
+	lock sync.RWMutex
+	bids []*book.Book
+	asks []*book.Book
+}
+
+func (ob *legacyOrderbook) SetWithSnapshot(bs *book.Snapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.bids = make([]*book.Book, 0)
+	ob.asks = make([]*book.Book, 0)
+	for _, order := range bs.Snapshot {
+		if order.Side == common.Bid {
+			ob.bids = append(ob.bids, order)
+		} else {
+			ob.asks = append(ob.asks, order)
+		}
+	}
+}
+
+func (ob *legacyOrderbook) UpdateWith(b *book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	side := &ob.asks
+	if b.Side == common.Bid {
+		side = &ob.bids
+	}
+	if len(*side) == 0 {
+		*side = append(*side, b)
+		return
+	}
+	for index, sOrder := range *side {
+		if sOrder.Price == b.Price {
+			if b.Count <= 0 {
+				*side = append((*side)[:index], (*side)[index+1:]...)
+				return
+			}
+			*side = append((*side)[:index], (*side)[index+1:]...)
+			break
+		}
+	}
+	*side = append(*side, b)
+	sort.Slice(*side, func(i, j int) bool {
+		if b.Side == common.Ask {
+			return (*side)[i].Price < (*side)[j].Price
+		}
+		return (*side)[i].Price > (*side)[j].Price
+	})
+}
+
+func (ob *legacyOrderbook) Checksum() uint32 {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	var checksumItems []string
+	for i := 0; i < 25; i++ {
+		if len(ob.bids) > i {
+			checksumItems = append(checksumItems, ob.bids[i].PriceJsNum.String())
+			checksumItems = append(checksumItems, ob.bids[i].AmountJsNum.String())
+		}
+		if len(ob.asks) > i {
+			checksumItems = append(checksumItems, ob.asks[i].PriceJsNum.String())
+			checksumItems = append(checksumItems, ob.asks[i].AmountJsNum.String())
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(checksumItems, ":")))
+}
+
+func testLevel(price float64, count int64, amount float64) *book.Book {
+	side := common.Bid
+	if amount < 0 {
+		side = common.Ask
+	}
+	abs := amount
+	if abs < 0 {
+		abs = -abs
+	}
+	return &book.Book{
+		Price:       price,
+		PriceJsNum:  json.Number(strconv.FormatFloat(price, 'f', -1, 64)),
+		Count:       count,
+		Amount:      abs,
+		AmountJsNum: json.Number(strconv.FormatFloat(amount, 'f', -1, 64)),
+		Side:        side,
+	}
+}
+
+func testSnapshot(levels int) *book.Snapshot {
+	snap := &book.Snapshot{Snapshot: make([]*book.Book, 0, levels*2)}
+	for i := 0; i < levels; i++ {
+		snap.Snapshot = append(snap.Snapshot, testLevel(10000-float64(i), 1, 1))
+	}
+	for i := 0; i < levels; i++ {
+		snap.Snapshot = append(snap.Snapshot, testLevel(10001+float64(i), 1, -1))
+	}
+	return snap
+}
+
+// testUpdates generates a random stream of updates against testSnapshot which,
+// like the bitfinex feed, only removes levels that are present in the book.
+func testUpdates(levels, n int) []*book.Book {
+	r := rand.New(rand.NewSource(1))
+	present := make(map[float64]bool)
+	for _, b := range testSnapshot(levels).Snapshot {
+		present[b.Price] = true
+	}
+	updates := make([]*book.Book, 0, n)
+	for len(updates) < n {
+		offset := float64(r.Intn(levels * 2))
+		count := int64(r.Intn(4))
+		amount := float64(r.Intn(100)+1) / 10
+		price := 10001 + offset
+		if r.Intn(2) == 0 {
+			price = 10000 - offset
+		} else {
+			amount = -amount
+		}
+		if count == 0 && !present[price] {
+			continue
+		}
+		present[price] = count > 0
+		updates = append(updates, testLevel(price, count, amount))
+	}
+	return updates
+}
+
+func TestOrderbookUpdateWith(t *testing.T) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testLevel(100, 1, 1),
+		testLevel(99, 1, 2),
+		testLevel(101, 1, -1),
+		testLevel(102, 1, -2),
+	}})
+
+	ob.UpdateWith(testLevel(99.5, 1, 3))
+	ob.UpdateWith(testLevel(100, 0, 1))
+	ob.UpdateWith(testLevel(101.5, 2, -5))
+	ob.UpdateWith(testLevel(102, 3, -4))
+
+	bids := ob.Bids()
+	asks := ob.Asks()
+	assert.Equal(t, []float64{99.5, 99}, []float64{bids[0].Price, bids[1].Price})
+	assert.Equal(t, []float64{101, 101.5, 102}, []float64{asks[0].Price, asks[1].Price, asks[2].Price})
+	assert.Equal(t, 4.0, asks[2].Amount)
+
+	top := ob.TopAsks(2)
+	assert.Len(t, top, 2)
+	best, ok := ob.BestBid()
+	assert.True(t, ok)
+	assert.Equal(t, 99.5, best.Price)
+
+	visited := 0
+	ob.RangeAsks(0, func(b book.Book) bool {
+		visited++
+		return b.Price < 101.5
+	})
+	assert.Equal(t, 2, visited)
+}
+
+func TestOrderbookChecksumMatchesLegacy(t *testing.T) {
+	snap := testSnapshot(100)
+	ob := newOrderbook("tBTCUSD")
+	legacy := &legacyOrderbook{}
+	ob.SetWithSnapshot(snap)
+	legacy.SetWithSnapshot(testSnapshot(100))
+	for _, u := range testUpdates(100, 5000) {
+		ob.UpdateWith(u)
+		legacy.UpdateWith(u)
+		if !assert.Equal(t, legacy.Checksum(), ob.Checksum()) {
+			return
+		}
+	}
+}
+
+func TestOrderbookMatchesLegacy(t *testing.T) {
+	ob := newOrderbook("tBTCUSD")
+	legacy := &legacyOrderbook{}
+	ob.SetWithSnapshot(testSnapshot(500))
+	legacy.SetWithSnapshot(testSnapshot(500))
+	for _, u := range testUpdates(500, 5000) {
+		ob.UpdateWith(u)
+		legacy.UpdateWith(u)
+	}
+	prices := func(levels []*book.Book) []float64 {
+		p := make([]float64, len(levels))
+		for i, l := range levels {
+			p[i] = l.Price
+		}
+		return p
+	}
+	bids, asks := ob.Len()
+	assert.Equal(t, len(legacy.bids), bids)
+	assert.Equal(t, len(legacy.asks), asks)
+	assert.Equal(t, prices(legacy.bids), prices(ob.bids.top(0)))
+	assert.Equal(t, prices(legacy.asks), prices(ob.asks.top(0)))
+}
+
+func benchmarkUpdateWith(b *testing.B, levels int, legacy bool) {
+	updates := testUpdates(levels, 10000)
+	var update func(*book.Book)
+	if legacy {
+		ob := &legacyOrderbook{}
+		ob.SetWithSnapshot(testSnapshot(levels))
+		update = ob.UpdateWith
+	} else {
+		ob := newOrderbook("tBTCUSD")
+		ob.SetWithSnapshot(testSnapshot(levels))
+		update = ob.UpdateWith
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		update(updates[i%len(updates)])
+	}
+}
+
+func BenchmarkOrderbookUpdateWith25(b *testing.B)        { benchmarkUpdateWith(b, 25, false) }
+func BenchmarkOrderbookUpdateWith250(b *testing.B)       { benchmarkUpdateWith(b, 250, false) }
+func BenchmarkLegacyOrderbookUpdateWith25(b *testing.B)  { benchmarkUpdateWith(b, 25, true) }
+func BenchmarkLegacyOrderbookUpdateWith250(b *testing.B) { benchmarkUpdateWith(b, 250, true) }
+
+// benchmarkInsertDelete inserts and removes a level in the middle of a book
+// with the given number of levels per side
+func benchmarkInsertDelete(b *testing.B, levels int) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(testSnapshot(levels))
+	r := rand.New(rand.NewSource(1))
+	inserts := make([]*book.Book, 1024)
+	removes := make([]*book.Book, len(inserts))
+	for i := range inserts {
+		price := 10000 - float64(r.Intn(levels)) - 0.5
+		inserts[i] = testLevel(price, 1, 1)
+		removes[i] = testLevel(price, 0, 1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.UpdateWith(inserts[i%len(inserts)])
+		ob.UpdateWith(removes[i%len(removes)])
+	}
+}
+
+func BenchmarkOrderbookInsertDelete1k(b *testing.B)   { benchmarkInsertDelete(b, 1000) }
+func BenchmarkOrderbookInsertDelete10k(b *testing.B)  { benchmarkInsertDelete(b, 10000) }
+func BenchmarkOrderbookInsertDelete100k(b *testing.B) { benchmarkInsertDelete(b, 100000) }
+
+func BenchmarkOrderbookChecksum(b *testing.B) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(testSnapshot(250))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.Checksum()
+	}
+}
+
+func BenchmarkLegacyOrderbookChecksum(b *testing.B) {
+	ob := &legacyOrderbook{}
+	ob.SetWithSnapshot(testSnapshot(250))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.Checksum()
+	}
+}
+
+func BenchmarkOrderbookTopBids(b *testing.B) {
+	ob := newOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(testSnapshot(250))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.RangeBids(10, func(book.Book) bool { return true })
+	}
+}
@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"github.com/op/go-logging"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
 	"time"
 )
 
@@ -11,17 +13,82 @@ type Parameters struct {
 	ReconnectInterval      time.Duration
 	ReconnectAttempts      int
 	reconnectTry           int
+	// overrides ReconnectInterval and ReconnectAttempts, e.g. with an
+	// ExponentialBackoff or RetryForever
+	ReconnectStrategy      ReconnectStrategy
+	// consecutive failed reconnects opening the circuit breaker, which then
+	// holds all reconnects for CircuitBreakerCooldown. Zero disables it.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
 	ShutdownTimeout        time.Duration
 	CapacityPerConnection  int
+	// assigns subscriptions to connections, MostAvailable if nil
+	ShardingPolicy         ShardingPolicy
+	// Deprecated: use Log, which takes precedence
 	Logger                 *logging.Logger
+	// e.g. logger.NewSlog or logger.NewGoLogging, go-logging Logger if nil
+	Log                    logger.Logger
+	// receives message rates, reconnects, queue depths and ping round trips,
+	// e.g. a metrics.Registry
+	Metrics                metrics.Sink
+	// captures every frame of the websocket transport, see NewReplayFactory
+	Recorder               *Recorder
 
 	ResubscribeOnReconnect bool
 
 	HeartbeatTimeout       time.Duration
 	LogTransport           bool
+	// interval between ping requests measuring the round trip time, zero
+	// disables pings. The connection is restarted when a pong is missing for
+	// longer than PongTimeout, checked on the next ping. PongTimeout defaults
+	// to three ping intervals, so a single slow pong does not restart the
+	// connection, and should be kept at two intervals at least.
+	PingInterval           time.Duration
+	PongTimeout            time.Duration
 
 	URL                    string
 	ManageOrderbook        bool
+	// delay before resubscribing a book after repeated checksum mismatches,
+	// doubled on every further mismatch up to BookResyncMaxBackoff
+	BookResyncBackoff      time.Duration
+	BookResyncMaxBackoff   time.Duration
+
+	// enable the SEQ_ALL flag, deliver messages in an Envelope and detect gaps
+	ManageSequence         bool
+	SequenceRecovery       SequenceRecovery
+	// enable the TIMESTAMP flag, deliver messages in an Envelope with the server
+	// timestamp and track MessageLatency
+	ServerTimestamps       bool
+	// enable the BULK_UPDATES flag, book updates are delivered in batches as
+	// book.BulkUpdate and applied atomically to managed books
+	BulkBookUpdates        bool
+
+	// track open positions and mark them to market using public price feeds
+	ManagePositions        bool
+	PositionThresholds     PositionThresholds
+
+	// minimum interval between two calc requests, requests made in between
+	// are merged into one
+	CalcThrottle           time.Duration
+}
+
+// logger returns Log, or adapts the go-logging Logger if not set
+func (p *Parameters) logger() logger.Logger {
+	if p.Log != nil {
+		return p.Log
+	}
+	if p.Logger != nil {
+		return logger.NewGoLogging(p.Logger)
+	}
+	return logger.Nop()
+}
+
+// metrics returns the Metrics sink, discarding metrics if not set
+func (p *Parameters) metrics() metrics.Sink {
+	if p.Metrics != nil {
+		return p.Metrics
+	}
+	return metrics.Nop()
 }
 
 func NewDefaultParameters() *Parameters {
@@ -31,11 +98,22 @@ func NewDefaultParameters() *Parameters {
 		ReconnectInterval:      time.Second * 3,
 		reconnectTry:           0,
 		ReconnectAttempts:      15,
+		CircuitBreakerCooldown: time.Minute,
 		URL:                    productionBaseURL,
 		ManageOrderbook:        false,
+		BookResyncBackoff:      time.Second,
+		BookResyncMaxBackoff:   time.Second * 30,
+		ManagePositions:        false,
+		ManageSequence:         false,
+		SequenceRecovery:       SequenceRecoveryEvent,
+		ServerTimestamps:       false,
+		BulkBookUpdates:        false,
+		CalcThrottle:           time.Second,
 		ShutdownTimeout:        time.Second * 5,
 		ResubscribeOnReconnect: true,
 		HeartbeatTimeout:       time.Second * 30,
+		PingInterval:           time.Second * 10,
+		PongTimeout:            time.Second * 30,
 		LogTransport:           false,           // log transport send/recv
 		Logger:                 logging.MustGetLogger("bitfinex-ws"),
 	}
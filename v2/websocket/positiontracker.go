@@ -0,0 +1,405 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+	"github.com/vx416/bitfinex-api-go/pkg/models/derivatives"
+	"github.com/vx416/bitfinex-api-go/pkg/models/position"
+	"github.com/vx416/bitfinex-api-go/pkg/models/ticker"
+)
+
+// PositionAlertKind identifies which threshold a PositionAlert refers to.
+type PositionAlertKind string
+
+const (
+	PositionAlertLiquidation PositionAlertKind = "liquidation"
+	PositionAlertLoss        PositionAlertKind = "loss"
+	PositionAlertLeverage    PositionAlertKind = "leverage"
+)
+
+// PositionThresholds configures when the position tracker emits alerts. A zero
+// value disables the corresponding alert.
+type PositionThresholds struct {
+	// LiquidationDistance alerts when the distance between the mark price and the
+	// liquidation price, as a fraction of the mark price, falls to or below this value.
+	LiquidationDistance float64
+	// UnrealizedLoss alerts when the unrealized loss (in quote currency) reaches this value.
+	UnrealizedLoss float64
+	// Leverage alerts when the effective leverage reaches this value.
+	Leverage float64
+}
+
+// TrackedPosition is a position marked to market with the latest known price.
+type TrackedPosition struct {
+	Position position.Position
+
+	MarkPrice           float64
+	MarkUpdated         time.Time
+	UnrealizedPnL       float64
+	UnrealizedPnLPerc   float64
+	LiquidationDistance float64 // fraction of the mark price, zero if unknown
+	EffectiveLeverage   float64
+}
+
+// PositionAlert is published on the listener channel when a tracked position
+// crosses one of the configured PositionThresholds. Breached is false when the
+// position recovers back across the threshold.
+type PositionAlert struct {
+	Symbol    string
+	Kind      PositionAlertKind
+	Breached  bool
+	Value     float64
+	Threshold float64
+	Position  TrackedPosition
+}
+
+// PositionTracker keeps the latest state of every open position and marks it
+// to market whenever a new price arrives for its symbol.
+type PositionTracker struct {
+	lock sync.RWMutex
+
+	thresholds PositionThresholds
+	positions  map[string]*TrackedPosition
+	marks      map[string]float64
+	breached   map[string]map[PositionAlertKind]bool
+}
+
+func newPositionTracker(thresholds PositionThresholds) *PositionTracker {
+	return &PositionTracker{
+		thresholds: thresholds,
+		positions:  make(map[string]*TrackedPosition),
+		marks:      make(map[string]float64),
+		breached:   make(map[string]map[PositionAlertKind]bool),
+	}
+}
+
+// isDerivativeSymbol returns true for perpetual contract symbols, which are
+// marked with the status channel rather than the ticker.
+func isDerivativeSymbol(symbol string) bool {
+	return strings.Contains(symbol, "F0:")
+}
+
+// Positions returns a copy of every tracked position.
+func (pt *PositionTracker) Positions() []TrackedPosition {
+	pt.lock.RLock()
+	defer pt.lock.RUnlock()
+	ps := make([]TrackedPosition, 0, len(pt.positions))
+	for _, p := range pt.positions {
+		ps = append(ps, *p)
+	}
+	return ps
+}
+
+// Position returns a copy of the tracked position for the given symbol.
+func (pt *PositionTracker) Position(symbol string) (TrackedPosition, bool) {
+	pt.lock.RLock()
+	defer pt.lock.RUnlock()
+	if p, ok := pt.positions[symbol]; ok {
+		return *p, true
+	}
+	return TrackedPosition{}, false
+}
+
+// setSnapshot replaces all tracked positions and returns any triggered alerts
+// and the symbols no longer tracked, those missing from the snapshot or closed.
+func (pt *PositionTracker) setSnapshot(snap *position.Snapshot) ([]*PositionAlert, []string) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	previous := pt.positions
+	pt.positions = make(map[string]*TrackedPosition)
+	pt.breached = make(map[string]map[PositionAlertKind]bool)
+	alerts := make([]*PositionAlert, 0)
+	candidates := make([]string, 0, len(previous))
+	for symbol := range previous {
+		candidates = append(candidates, symbol)
+	}
+	for _, p := range snap.Snapshot {
+		a, closed := pt.set(p)
+		alerts = append(alerts, a...)
+		candidates = append(candidates, closed...)
+	}
+	stopped := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, symbol := range candidates {
+		if _, ok := pt.positions[symbol]; !ok && !seen[symbol] {
+			seen[symbol] = true
+			stopped = append(stopped, symbol)
+		}
+	}
+	sort.Strings(stopped)
+	return alerts, stopped
+}
+
+// update stores the given position, removing it if it has been closed. The
+// symbols no longer tracked are returned with the alerts.
+func (pt *PositionTracker) update(p *position.Position) ([]*PositionAlert, []string) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	return pt.set(p)
+}
+
+// remove stops tracking the position for the given symbol.
+func (pt *PositionTracker) remove(symbol string) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	delete(pt.positions, symbol)
+	delete(pt.breached, symbol)
+}
+
+// mark applies a new mark price to the symbol and returns any triggered alerts.
+func (pt *PositionTracker) mark(symbol string, price float64) []*PositionAlert {
+	if price <= 0 {
+		return nil
+	}
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pt.marks[symbol] = price
+	tp, ok := pt.positions[symbol]
+	if !ok {
+		return nil
+	}
+	tp.MarkPrice = price
+	tp.MarkUpdated = time.Now()
+	pt.calculate(tp)
+	return pt.checkThresholds(tp)
+}
+
+func (pt *PositionTracker) set(p *position.Position) ([]*PositionAlert, []string) {
+	if p.Status == "CLOSED" || p.Amount == 0 {
+		delete(pt.positions, p.Symbol)
+		delete(pt.breached, p.Symbol)
+		return nil, []string{p.Symbol}
+	}
+	tp := &TrackedPosition{Position: *p}
+	if old, ok := pt.positions[p.Symbol]; ok {
+		tp.MarkUpdated = old.MarkUpdated
+	}
+	if m, ok := pt.marks[p.Symbol]; ok {
+		tp.MarkPrice = m
+	}
+	pt.positions[p.Symbol] = tp
+	pt.calculate(tp)
+	return pt.checkThresholds(tp), nil
+}
+
+func (pt *PositionTracker) calculate(tp *TrackedPosition) {
+	p := tp.Position
+	if tp.MarkPrice <= 0 {
+		// no price yet, fall back to the values last calculated by bitfinex
+		tp.UnrealizedPnL = p.ProfitLoss
+		tp.UnrealizedPnLPerc = p.ProfitLossPercentage
+		tp.EffectiveLeverage = p.Leverage
+		tp.LiquidationDistance = 0
+		return
+	}
+	notional := math.Abs(p.Amount) * tp.MarkPrice
+	tp.UnrealizedPnL = p.Amount * (tp.MarkPrice - p.BasePrice)
+	if p.BasePrice > 0 {
+		tp.UnrealizedPnLPerc = tp.UnrealizedPnL / (math.Abs(p.Amount) * p.BasePrice) * 100
+	}
+	if p.LiquidationPrice > 0 {
+		tp.LiquidationDistance = math.Abs(tp.MarkPrice-p.LiquidationPrice) / tp.MarkPrice
+	} else {
+		tp.LiquidationDistance = 0
+	}
+	// equity is the margin posted for the position plus its unrealized PnL
+	margin := p.Collateral
+	if margin <= 0 && p.Leverage > 0 {
+		margin = math.Abs(p.Amount) * p.BasePrice / p.Leverage
+	}
+	equity := margin + tp.UnrealizedPnL
+	if equity > 0 {
+		tp.EffectiveLeverage = notional / equity
+	} else {
+		tp.EffectiveLeverage = math.Inf(1)
+	}
+}
+
+func (pt *PositionTracker) checkThresholds(tp *TrackedPosition) []*PositionAlert {
+	alerts := make([]*PositionAlert, 0)
+	symbol := tp.Position.Symbol
+	if _, ok := pt.breached[symbol]; !ok {
+		pt.breached[symbol] = make(map[PositionAlertKind]bool)
+	}
+	check := func(kind PositionAlertKind, value, threshold float64, breached bool) {
+		if threshold <= 0 {
+			return
+		}
+		if pt.breached[symbol][kind] == breached {
+			return
+		}
+		pt.breached[symbol][kind] = breached
+		alerts = append(alerts, &PositionAlert{
+			Symbol:    symbol,
+			Kind:      kind,
+			Breached:  breached,
+			Value:     value,
+			Threshold: threshold,
+			Position:  *tp,
+		})
+	}
+	if tp.LiquidationDistance > 0 {
+		check(PositionAlertLiquidation, tp.LiquidationDistance, pt.thresholds.LiquidationDistance,
+			tp.LiquidationDistance <= pt.thresholds.LiquidationDistance)
+	}
+	check(PositionAlertLoss, tp.UnrealizedPnL, pt.thresholds.UnrealizedLoss,
+		tp.UnrealizedPnL <= -pt.thresholds.UnrealizedLoss)
+	check(PositionAlertLeverage, tp.EffectiveLeverage, pt.thresholds.Leverage,
+		tp.EffectiveLeverage >= pt.thresholds.Leverage)
+	return alerts
+}
+
+// handle position messages from the authenticated channel and make sure there
+// is a price feed for every tracked symbol
+func (c *Client) trackPosition(obj interface{}) {
+	var alerts []*PositionAlert
+	var stopped []string
+	switch p := obj.(type) {
+	case *position.Snapshot:
+		alerts, stopped = c.positions.setSnapshot(p)
+		for _, pos := range p.Snapshot {
+			if _, ok := c.positions.Position(pos.Symbol); ok {
+				c.ensureMarkSubscription(pos.Symbol)
+			}
+		}
+	case *position.New:
+		pos := position.Position(*p)
+		if alerts, stopped = c.positions.update(&pos); len(stopped) == 0 {
+			c.ensureMarkSubscription(pos.Symbol)
+		}
+	case *position.Update:
+		pos := position.Position(*p)
+		if alerts, stopped = c.positions.update(&pos); len(stopped) == 0 {
+			c.ensureMarkSubscription(pos.Symbol)
+		}
+	case *position.Cancel:
+		c.positions.remove(p.Symbol)
+		stopped = []string{p.Symbol}
+	default:
+		return
+	}
+	for _, symbol := range stopped {
+		c.releaseMarkSubscription(symbol)
+	}
+	c.publishPositionAlerts(alerts)
+}
+
+// apply public price updates to the tracked positions
+func (c *Client) markPositions(obj interface{}) {
+	var alerts []*PositionAlert
+	switch m := obj.(type) {
+	case *ticker.Ticker:
+		if !isDerivativeSymbol(m.Symbol) {
+			alerts = c.positions.mark(m.Symbol, m.LastPrice)
+		}
+	case *derivatives.DerivativeStatus:
+		alerts = c.positions.mark(m.Symbol, m.MarkPrice)
+	default:
+		return
+	}
+	c.publishPositionAlerts(alerts)
+}
+
+func (c *Client) publishPositionAlerts(alerts []*PositionAlert) {
+	for _, alert := range alerts {
+		c.publish(alert)
+	}
+}
+
+// markSubscription is the mark price feed of a tracked position, subID is empty
+// while subscribing or if the feed belongs to the user
+type markSubscription struct {
+	subID string
+}
+
+// ensureMarkSubscription subscribes to the price feed of a symbol in the
+// background, messages of the listen goroutine are not held up by a new
+// connection
+func (c *Client) ensureMarkSubscription(symbol string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := c.positionSubs[symbol]; ok {
+		return
+	}
+	mark := &markSubscription{}
+	c.positionSubs[symbol] = mark
+	c.spawnLocked(func() {
+		c.subscribeMark(symbol, mark)
+	})
+}
+
+func (c *Client) subscribeMark(symbol string, mark *markSubscription) {
+	channel, key := ChanTicker, ""
+	if isDerivativeSymbol(symbol) {
+		channel, key = ChanStatus, fmt.Sprintf("%s:%s", common.StatusType("deriv"), symbol)
+	}
+	// reuse an existing subscription if the user already has one
+	existing := c.subscriptions.lookupByRequest(func(r *SubscriptionRequest) bool {
+		if channel == ChanStatus {
+			return r.Channel == channel && r.Key == key
+		}
+		return r.Channel == channel && r.Symbol == symbol
+	})
+	if len(existing) > 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var subID string
+	var err error
+	if channel == ChanStatus {
+		subID, err = c.SubscribeStatus(ctx, symbol, common.StatusType("deriv"))
+	} else {
+		subID, err = c.SubscribeTicker(ctx, symbol)
+	}
+	c.mtx.Lock()
+	current := c.positionSubs[symbol]
+	if err != nil && current == mark {
+		// subscribe again with the next position update
+		delete(c.positionSubs, symbol)
+	}
+	if err == nil && current == mark {
+		mark.subID = subID
+	}
+	c.mtx.Unlock()
+	if err != nil {
+		c.log.Warningf("could not subscribe to mark price for position %s: %s", symbol, err.Error())
+		return
+	}
+	if current != mark {
+		// the position was closed while subscribing
+		c.unsubscribeMark(symbol, subID)
+	}
+}
+
+// releaseMarkSubscription unsubscribes from the price feed of a closed position
+// in the background
+func (c *Client) releaseMarkSubscription(symbol string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	mark, ok := c.positionSubs[symbol]
+	delete(c.positionSubs, symbol)
+	if !ok || mark.subID == "" {
+		// not subscribed by the tracker or still subscribing
+		return
+	}
+	subID := mark.subID
+	c.spawnLocked(func() {
+		c.unsubscribeMark(symbol, subID)
+	})
+}
+
+func (c *Client) unsubscribeMark(symbol, subID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := c.Unsubscribe(ctx, subID); err != nil {
+		c.log.Warningf("could not unsubscribe from mark price for position %s: %s", symbol, err.Error())
+	}
+}
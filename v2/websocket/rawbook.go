@@ -0,0 +1,288 @@
+package websocket
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// rawBookSide holds the individual orders of one side of a raw book, ordered
+// by price (rate for funding books, best first) and then by order ID so older
+// orders keep priority.
+type rawBookSide struct {
+	desc    bool
+	funding bool
+	orders  []*book.Book
+}
+
+func newRawBookSide(desc, funding bool) *rawBookSide {
+	return &rawBookSide{desc: desc, funding: funding, orders: make([]*book.Book, 0)}
+}
+
+func (s *rawBookSide) key(b *book.Book) float64 {
+	if s.funding {
+		return b.Rate
+	}
+	return b.Price
+}
+
+func (s *rawBookSide) less(a, b *book.Book) bool {
+	if ka, kb := s.key(a), s.key(b); ka != kb {
+		if s.desc {
+			return ka > kb
+		}
+		return ka < kb
+	}
+	return a.ID < b.ID
+}
+
+func (s *rawBookSide) search(b *book.Book) (int, bool) {
+	i := sort.Search(len(s.orders), func(i int) bool {
+		return !s.less(s.orders[i], b)
+	})
+	return i, i < len(s.orders) && s.orders[i].ID == b.ID
+}
+
+func (s *rawBookSide) insert(b *book.Book) {
+	i, _ := s.search(b)
+	s.orders = append(s.orders, nil)
+	copy(s.orders[i+1:], s.orders[i:])
+	s.orders[i] = b
+}
+
+func (s *rawBookSide) remove(b *book.Book) {
+	i, ok := s.search(b)
+	if !ok {
+		return
+	}
+	copy(s.orders[i:], s.orders[i+1:])
+	s.orders[len(s.orders)-1] = nil
+	s.orders = s.orders[:len(s.orders)-1]
+}
+
+// aggregate sums the orders at each price into a single price level
+func (s *rawBookSide) aggregate(side common.OrderSide) []*book.Book {
+	levels := make([]*book.Book, 0)
+	var level *book.Book
+	for _, o := range s.orders {
+		if level == nil || level.Price != o.Price {
+			level = &book.Book{
+				Symbol:     o.Symbol,
+				Price:      o.Price,
+				PriceJsNum: o.PriceJsNum,
+				Side:       side,
+				Action:     book.BookEntry,
+			}
+			levels = append(levels, level)
+		}
+		level.Count++
+		level.Amount += o.Amount
+	}
+	for _, l := range levels {
+		amount := l.Amount
+		if side == common.Ask {
+			amount = -amount
+		}
+		l.AmountJsNum = json.Number(strconv.FormatFloat(amount, 'f', -1, 64))
+	}
+	return levels
+}
+
+// aggregateFunding sums the funding orders with the same rate and period
+func (s *rawBookSide) aggregateFunding(side common.OrderSide) []*book.Book {
+	type fundingKey struct {
+		rate   float64
+		period int64
+	}
+	byKey := make(map[fundingKey]*book.Book)
+	levels := make([]*book.Book, 0)
+	for _, o := range s.orders {
+		k := fundingKey{rate: o.Rate, period: o.Period}
+		level, ok := byKey[k]
+		if !ok {
+			level = &book.Book{
+				Symbol: o.Symbol,
+				Rate:   o.Rate,
+				Period: o.Period,
+				Side:   side,
+				Action: book.BookEntry,
+			}
+			byKey[k] = level
+			levels = append(levels, level)
+		}
+		level.Count++
+		level.Amount += o.Amount
+	}
+	for _, l := range levels {
+		// funding bids (borrowers) carry a negative amount
+		amount := l.Amount
+		if side == common.Bid {
+			amount = -amount
+		}
+		l.AmountJsNum = json.Number(strconv.FormatFloat(amount, 'f', -1, 64))
+	}
+	return levels
+}
+
+// RawOrderbook is a locally managed raw (R0) book which tracks every individual
+// order by its ID rather than aggregating by price. Raw funding books order
+// offers by rate instead of price.
+type RawOrderbook struct {
+	lock sync.RWMutex
+
+	symbol  string
+	funding bool
+	orders  map[int64]*book.Book
+	bids    *rawBookSide
+	asks    *rawBookSide
+}
+
+func newRawOrderbook(symbol string) *RawOrderbook {
+	funding := book.IsFundingBook(symbol)
+	return &RawOrderbook{
+		symbol:  symbol,
+		funding: funding,
+		orders:  make(map[int64]*book.Book),
+		bids:    newRawBookSide(true, funding),
+		asks:    newRawBookSide(false, funding),
+	}
+}
+
+func (ob *RawOrderbook) Symbol() string {
+	return ob.symbol
+}
+
+// Order returns a copy of the order with the given ID.
+func (ob *RawOrderbook) Order(id int64) (book.Book, bool) {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	if o, ok := ob.orders[id]; ok {
+		return *o, true
+	}
+	return book.Book{}, false
+}
+
+// Bids returns a dereferenced copy of all bid orders, best price first.
+func (ob *RawOrderbook) Bids() []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return copyOrders(ob.bids.orders)
+}
+
+// Asks returns a dereferenced copy of all ask orders, best price first.
+func (ob *RawOrderbook) Asks() []book.Book {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return copyOrders(ob.asks.orders)
+}
+
+// Aggregated derives a price level Orderbook from the individual orders of a
+// trading book.
+func (ob *RawOrderbook) Aggregated() *Orderbook {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	agg := newOrderbook(ob.symbol)
+	agg.bids.reset(ob.bids.aggregate(common.Bid))
+	agg.asks.reset(ob.asks.aggregate(common.Ask))
+	return agg
+}
+
+// AggregatedFunding derives a FundingOrderbook, keyed by rate and period, from
+// the individual offers of a funding book.
+func (ob *RawOrderbook) AggregatedFunding() *FundingOrderbook {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	agg := newFundingOrderbook(ob.symbol)
+	agg.bids.reset(ob.bids.aggregateFunding(common.Bid))
+	agg.asks.reset(ob.asks.aggregateFunding(common.Ask))
+	return agg
+}
+
+func (ob *RawOrderbook) SetWithSnapshot(bs *book.Snapshot) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	ob.orders = make(map[int64]*book.Book, len(bs.Snapshot))
+	ob.bids = newRawBookSide(true, ob.funding)
+	ob.asks = newRawBookSide(false, ob.funding)
+	for _, order := range bs.Snapshot {
+		if ob.funding {
+			order = fundingLevel(order, true)
+		}
+		ob.insert(order)
+	}
+}
+
+// UpdateWith inserts, amends or removes (price of zero) the order with the ID of the given update.
+func (ob *RawOrderbook) UpdateWith(b *book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.update(b)
+}
+
+// UpdateWithBulk applies a batch of updates atomically.
+func (ob *RawOrderbook) UpdateWithBulk(updates []*book.Book) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	for _, b := range updates {
+		ob.update(b)
+	}
+}
+
+func (ob *RawOrderbook) update(b *book.Book) {
+	if ob.funding {
+		b = fundingLevel(b, true)
+	}
+	if existing, ok := ob.orders[b.ID]; ok {
+		ob.sideOf(existing).remove(existing)
+		delete(ob.orders, b.ID)
+	}
+	if b.Action == book.BookRemoveEntry {
+		return
+	}
+	ob.insert(b)
+}
+
+func (ob *RawOrderbook) insert(b *book.Book) {
+	ob.orders[b.ID] = b
+	ob.sideOf(b).insert(b)
+}
+
+func (ob *RawOrderbook) sideOf(b *book.Book) *rawBookSide {
+	if b.Side == common.Bid {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// Checksum calculates the crc32 checksum of the book using the raw book
+// format, where the order ID takes the place of the price.
+func (ob *RawOrderbook) Checksum() uint32 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	buf := make([]byte, 0, checksumDepth*4*16)
+	for i := 0; i < checksumDepth; i++ {
+		if len(ob.bids.orders) > i {
+			buf = appendChecksumItem(buf, strconv.FormatInt(ob.bids.orders[i].ID, 10))
+			buf = appendChecksumItem(buf, ob.bids.orders[i].AmountJsNum.String())
+		}
+		if len(ob.asks.orders) > i {
+			buf = appendChecksumItem(buf, strconv.FormatInt(ob.asks.orders[i].ID, 10))
+			buf = appendChecksumItem(buf, ob.asks.orders[i].AmountJsNum.String())
+		}
+	}
+	return crc32.ChecksumIEEE(buf)
+}
+
+func copyOrders(orders []*book.Book) []book.Book {
+	cpy := make([]book.Book, len(orders))
+	for i, o := range orders {
+		cpy[i] = *o
+	}
+	return cpy
+}
@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+)
+
+func testRawOrder(t *testing.T, raw string) *book.Book {
+	nums, err := ConvertBytesToJsonNumberArray([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]interface{}, len(nums))
+	for i, n := range nums {
+		f, _ := n.(json.Number).Float64()
+		data[i] = f
+	}
+	b, err := book.FromRaw("tBTCUSD", "R0", data, nums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRawOrderbook(t *testing.T) {
+	ob := newRawOrderbook("tBTCUSD")
+	ob.SetWithSnapshot(&book.Snapshot{Snapshot: []*book.Book{
+		testRawOrder(t, `[3,100,0.5]`),
+		testRawOrder(t, `[1,100,1]`),
+		testRawOrder(t, `[2,99,2]`),
+		testRawOrder(t, `[4,101,-1]`),
+		testRawOrder(t, `[5,101,-1.5]`),
+	}})
+
+	// amend, insert & delete by order ID
+	ob.UpdateWith(testRawOrder(t, `[1,100,0.25]`))
+	ob.UpdateWith(testRawOrder(t, `[6,102,-3]`))
+	ob.UpdateWith(testRawOrder(t, `[4,0,-1]`))
+
+	bids := ob.Bids()
+	assert.Len(t, bids, 3)
+	assert.Equal(t, []int64{1, 3, 2}, []int64{bids[0].ID, bids[1].ID, bids[2].ID})
+	assert.Equal(t, 0.25, bids[0].Amount)
+	asks := ob.Asks()
+	assert.Equal(t, []int64{5, 6}, []int64{asks[0].ID, asks[1].ID})
+	_, ok := ob.Order(4)
+	assert.False(t, ok)
+
+	expected := crc32.ChecksumIEEE([]byte("1:0.25:5:-1.5:3:0.5:6:-3:2:2"))
+	assert.Equal(t, expected, ob.Checksum())
+
+	agg := ob.Aggregated()
+	aggBids := agg.Bids()
+	assert.Len(t, aggBids, 2)
+	assert.Equal(t, 100.0, aggBids[0].Price)
+	assert.Equal(t, 0.75, aggBids[0].Amount)
+	assert.Equal(t, int64(2), aggBids[0].Count)
+	aggAsks := agg.Asks()
+	assert.Equal(t, "-1.5", aggAsks[0].AmountJsNum.String())
+}
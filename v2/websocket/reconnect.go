@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ReconnectStrategy decides how long to wait before a reconnect attempt,
+// attempts start at 1. Returning false gives up reconnecting.
+type ReconnectStrategy interface {
+	NextDelay(attempt int) (time.Duration, bool)
+}
+
+// FixedReconnect waits the same interval before each of a limited number of
+// attempts. It is used with ReconnectInterval and ReconnectAttempts when no
+// ReconnectStrategy is set.
+type FixedReconnect struct {
+	Interval time.Duration
+	Attempts int
+}
+
+func (f *FixedReconnect) NextDelay(attempt int) (time.Duration, bool) {
+	if attempt > f.Attempts {
+		return 0, false
+	}
+	return f.Interval, true
+}
+
+// ExponentialBackoff multiplies the delay by Multiplier after every attempt up
+// to Max. Jitter randomly shortens each delay by up to the given fraction so
+// that many clients do not reconnect in lockstep. MaxAttempts of zero retries
+// forever.
+type ExponentialBackoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	Jitter      float64
+	MaxAttempts int
+}
+
+// NewExponentialBackoff creates a doubling backoff with 20% jitter.
+func NewExponentialBackoff(initial, max time.Duration, attempts int) *ExponentialBackoff {
+	return &ExponentialBackoff{Initial: initial, Max: max, Multiplier: 2, Jitter: 0.2, MaxAttempts: attempts}
+}
+
+// RetryForever creates a doubling backoff with 20% jitter which never gives up,
+// waiting at most max between attempts.
+func RetryForever(initial, max time.Duration) *ExponentialBackoff {
+	return NewExponentialBackoff(initial, max, 0)
+}
+
+func (e *ExponentialBackoff) NextDelay(attempt int) (time.Duration, bool) {
+	if e.MaxAttempts > 0 && attempt > e.MaxAttempts {
+		return 0, false
+	}
+	mult := e.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	delay := float64(e.Initial) * math.Pow(mult, float64(attempt-1))
+	if e.Max > 0 && delay > float64(e.Max) {
+		delay = float64(e.Max)
+	}
+	if e.Jitter > 0 {
+		delay -= delay * e.Jitter * rand.Float64()
+	}
+	return time.Duration(delay), true
+}
+
+// CircuitState is the state of the reconnect circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed allows reconnect attempts as given by the strategy.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen holds all reconnect attempts until the cooldown has passed.
+	CircuitOpen
+	// CircuitHalfOpen allows a single trial attempt after the cooldown.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitStateChanged is published when the reconnect circuit breaker changes state.
+type CircuitStateChanged struct {
+	From CircuitState
+	To   CircuitState
+}
+
+// ReconnectAttempt is published after every reconnect attempt, Err is nil if
+// the connection was established.
+type ReconnectAttempt struct {
+	SocketId SocketId
+	Attempt  int
+	Delay    time.Duration
+	Err      error
+}
+
+// circuitBreaker opens after threshold consecutive failed reconnects, shared
+// by all connections of a client. A zero threshold disables it.
+type circuitBreaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+// wait returns the remaining cooldown of an open breaker
+func (b *circuitBreaker) wait(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state != CircuitOpen {
+		return 0
+	}
+	if remaining := b.cooldown - now.Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// allow moves an open breaker past its cooldown into half-open
+func (b *circuitBreaker) allow(now time.Time) *CircuitStateChanged {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.cooldown {
+		return b.transition(CircuitHalfOpen)
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a reconnect attempt
+func (b *circuitBreaker) record(success bool, now time.Time) *CircuitStateChanged {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if success {
+		b.failures = 0
+		return b.transition(CircuitClosed)
+	}
+	b.failures++
+	if b.threshold > 0 && (b.state == CircuitHalfOpen || b.failures >= b.threshold) {
+		b.openedAt = now
+		return b.transition(CircuitOpen)
+	}
+	return nil
+}
+
+func (b *circuitBreaker) transition(to CircuitState) *CircuitStateChanged {
+	if b.state == to {
+		return nil
+	}
+	ev := &CircuitStateChanged{From: b.state, To: to}
+	b.state = to
+	return ev
+}
+
+// CircuitState returns the state of the reconnect circuit breaker.
+func (c *Client) CircuitState() CircuitState {
+	return c.breaker.State()
+}
+
+func (c *Client) reconnectStrategy() ReconnectStrategy {
+	if c.parameters.ReconnectStrategy != nil {
+		return c.parameters.ReconnectStrategy
+	}
+	return &FixedReconnect{Interval: c.parameters.ReconnectInterval, Attempts: c.parameters.ReconnectAttempts}
+}
+
+func (c *Client) isTerminal() bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.terminal
+}
+
+func (c *Client) publishCircuitState(ev *CircuitStateChanged) {
+	if ev == nil {
+		return
+	}
+	c.log.Infof("reconnect circuit breaker %s -> %s", ev.From, ev.To)
+	c.publish(ev)
+}
+
+func (c *Client) reconnect(socket *Socket, err error) error {
+	if c.isTerminal() {
+		// dont attempt to reconnect if terminal
+		return err
+	}
+	if !c.parameters.AutoReconnect {
+		return fmt.Errorf("AutoReconnect setting is disabled, do not reconnect: %s", err.Error())
+	}
+	strategy := c.reconnectStrategy()
+	for attempt := 1; ; attempt++ {
+		delay, ok := strategy.NextDelay(attempt)
+		if !ok {
+			break
+		}
+		// an open breaker holds attempts until its cooldown has passed
+		if wait := c.breaker.wait(time.Now()); wait > delay {
+			delay = wait
+		}
+		c.socketLog(socket.Id).Debugf("waiting %s until reconnect...", delay)
+		if !c.sleep(delay) {
+			return err
+		}
+		c.publishCircuitState(c.breaker.allow(time.Now()))
+		c.socketLog(socket.Id).Infof("reconnect attempt %d", attempt)
+		errReconnect := c.reconnectSocket(socket)
+		c.recordReconnect(socket.Id, errReconnect)
+		c.publishCircuitState(c.breaker.record(errReconnect == nil, time.Now()))
+		c.publish(&ReconnectAttempt{SocketId: socket.Id, Attempt: attempt, Delay: delay, Err: errReconnect})
+		if errReconnect == nil {
+			c.log.Debugf("reconnect OK")
+			return nil
+		}
+		c.socketLog(socket.Id).Warningf("reconnect failed: %s", errReconnect.Error())
+		err = errReconnect
+	}
+	if err != nil {
+		c.socketLog(socket.Id).Errorf("could not reconnect: %s", err.Error())
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Run("doubles up to max", func(t *testing.T) {
+		e := &ExponentialBackoff{Initial: time.Second, Max: time.Second * 5, Multiplier: 2, MaxAttempts: 5}
+		expected := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+		for i, exp := range expected {
+			d, ok := e.NextDelay(i + 1)
+			assert.True(t, ok)
+			assert.Equal(t, exp, d)
+		}
+		_, ok := e.NextDelay(6)
+		assert.False(t, ok)
+	})
+
+	t.Run("jitter shortens delays", func(t *testing.T) {
+		e := RetryForever(time.Second, time.Second*30)
+		full := time.Second
+		for attempt := 1; attempt < 100; attempt++ {
+			d, ok := e.NextDelay(attempt)
+			assert.True(t, ok)
+			assert.True(t, d <= full && d >= full*8/10, "attempt %d: %s not within 20%% of %s", attempt, d, full)
+			if full *= 2; full > time.Second*30 {
+				full = time.Second * 30
+			}
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+
+	assert.Nil(t, b.record(false, now))
+	ev := b.record(false, now)
+	assert.Equal(t, &CircuitStateChanged{From: CircuitClosed, To: CircuitOpen}, ev)
+	assert.Equal(t, time.Minute, b.wait(now))
+	assert.Nil(t, b.allow(now.Add(time.Second*30)))
+
+	// a failed trial attempt opens the breaker again
+	ev = b.allow(now.Add(time.Minute))
+	assert.Equal(t, &CircuitStateChanged{From: CircuitOpen, To: CircuitHalfOpen}, ev)
+	ev = b.record(false, now.Add(time.Minute))
+	assert.Equal(t, &CircuitStateChanged{From: CircuitHalfOpen, To: CircuitOpen}, ev)
+	assert.Equal(t, time.Second*30, b.wait(now.Add(time.Second*90)))
+
+	// a successful trial closes it
+	b.allow(now.Add(time.Minute * 2))
+	ev = b.record(true, now.Add(time.Minute*2))
+	assert.Equal(t, &CircuitStateChanged{From: CircuitHalfOpen, To: CircuitClosed}, ev)
+	assert.Equal(t, CircuitClosed, b.State())
+
+	// disabled without threshold
+	b = newCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, b.record(false, now))
+	}
+	assert.Equal(t, time.Duration(0), b.wait(now))
+}
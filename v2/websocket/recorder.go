@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+)
+
+// Directions of a recorded frame.
+const (
+	FrameIn  = "in"  // received from the server
+	FrameOut = "out" // sent to the server
+)
+
+// Frame is a raw websocket frame captured by a Recorder.
+type Frame struct {
+	Time      time.Time `json:"ts"`
+	SocketId  SocketId  `json:"socket"`
+	Conn      int       `json:"conn"` // n-th connection opened while recording, reconnects open a new one
+	Direction string    `json:"dir"`
+	Data      string    `json:"data"`
+}
+
+// Recorder writes every frame of the websocket transport as a JSON line,
+// credentials of sent frames are redacted. Recorded sessions are replayed by a
+// ReplayFactory.
+type Recorder struct {
+	lock  sync.Mutex
+	enc   *json.Encoder
+	conns int
+	err   error
+}
+
+// NewRecorder creates a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes a frame. Frames are dropped after a write error, which is
+// returned once and kept by Err.
+func (r *Recorder) Record(f *Frame) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return nil
+	}
+	r.err = r.enc.Encode(f)
+	return r.err
+}
+
+// Err returns the first error writing a frame.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// newConn numbers a new connection
+func (r *Recorder) newConn() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	conn := r.conns
+	r.conns++
+	return conn
+}
+
+// ReadFrames reads the frames written by a Recorder.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	frames := make([]Frame, 0)
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		err := dec.Decode(&f)
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+// socketAware transports are told the id of the socket they are connected for
+type socketAware interface {
+	setSocketId(socketId SocketId)
+}
+
+func (w *ws) setSocketId(socketId SocketId) {
+	w.socketId = socketId
+}
+
+// record captures a frame if the transport has a recorder
+func (w *ws) record(direction string, data []byte) {
+	if w.recorder == nil {
+		return
+	}
+	msg := string(data)
+	if direction == FrameOut {
+		msg = logger.Redact(msg)
+	}
+	f := &Frame{Time: time.Now(), SocketId: w.socketId, Conn: w.conn, Direction: direction, Data: msg}
+	if err := w.recorder.Record(f); err != nil {
+		w.log.Warningf("could not record frame: %s", err)
+	}
+}
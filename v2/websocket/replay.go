@@ -0,0 +1,315 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayFactory creates transports replaying the frames received during a
+// recorded session, so a client can be tested offline against real sessions.
+// The n-th created transport replays the n-th recorded connection. Events
+// answering a recorded subscribe or auth request are held back until the client
+// sends the same request and carry its subscription id, other frames sent by
+// the client are discarded. Frames are delivered at recorded speed unless
+// changed by WithSpeed or Stepped.
+type ReplayFactory struct {
+	frames  []Frame // received frames in recorded order
+	sent    []Frame
+	speed   float64
+	stepped bool
+
+	lock      sync.Mutex
+	conns     int
+	start     time.Time // replay start, set when the first transport connects
+	released  int       // frames released by Step
+	step      chan struct{}
+	delivered int
+	done      chan struct{}
+}
+
+// NewReplayFactory creates a factory replaying the received frames of a
+// recorded session, see ReadFrames.
+func NewReplayFactory(frames []Frame) *ReplayFactory {
+	in, sent := make([]Frame, 0, len(frames)), make([]Frame, 0)
+	for _, f := range frames {
+		if f.Direction == FrameIn {
+			in = append(in, f)
+		} else {
+			sent = append(sent, f)
+		}
+	}
+	r := &ReplayFactory{
+		frames: in,
+		sent:   sent,
+		speed:  1,
+		step:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if len(in) == 0 {
+		close(r.done)
+	}
+	return r
+}
+
+// WithSpeed scales the recorded delays between frames, 2 replays twice as
+// fast. Frames are replayed without delays if speed is 0.
+func (r *ReplayFactory) WithSpeed(speed float64) *ReplayFactory {
+	r.speed = speed
+	return r
+}
+
+// Stepped replays a frame for every call of Step.
+func (r *ReplayFactory) Stepped() *ReplayFactory {
+	r.stepped = true
+	return r
+}
+
+// Step releases the next frame of a stepped replay, returns false once every
+// frame has been released.
+func (r *ReplayFactory) Step() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.released >= len(r.frames) {
+		return false
+	}
+	r.released++
+	close(r.step)
+	r.step = make(chan struct{})
+	return true
+}
+
+// Done is closed once every frame has been delivered to the client.
+func (r *ReplayFactory) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *ReplayFactory) Create() Asynchronous {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	conn := r.conns
+	r.conns++
+	a := &replayAsync{
+		factory:    r,
+		conn:       conn,
+		downstream: make(chan []byte),
+		kill:       make(chan struct{}),
+		quit:       make(chan error, 1),
+		requests:   make(map[string][]string),
+		subIds:     make(map[string]string),
+		matched:    make(chan struct{}),
+	}
+	for _, f := range r.sent {
+		req := &SubscriptionRequest{}
+		if f.Conn != conn || json.Unmarshal([]byte(f.Data), req) != nil || req.SubID == "" {
+			continue
+		}
+		key := replayKey(req)
+		a.requests[key] = append(a.requests[key], req.SubID)
+		a.subIds[req.SubID] = ""
+	}
+	return a
+}
+
+// replayKey identifies a request regardless of its subscription id and
+// credentials
+func replayKey(req *SubscriptionRequest) string {
+	return strings.Join([]string{req.Event, req.Channel, req.Symbol, req.Precision, req.Frequency, req.Key, req.Len, req.Pair}, "|")
+}
+
+// started returns the replay start time, starting the replay on first call
+func (r *ReplayFactory) started() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	return r.start
+}
+
+// wait blocks until the i-th frame is due, returns false if killed first
+func (r *ReplayFactory) wait(i int, start time.Time, kill <-chan struct{}) bool {
+	if r.stepped {
+		for {
+			r.lock.Lock()
+			released, step := r.released, r.step
+			r.lock.Unlock()
+			if released > i {
+				return true
+			}
+			select {
+			case <-step:
+			case <-kill:
+				return false
+			}
+		}
+	}
+	if r.speed <= 0 {
+		return true
+	}
+	offset := r.frames[i].Time.Sub(r.frames[0].Time)
+	delay := time.Until(start.Add(time.Duration(float64(offset) / r.speed)))
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-kill:
+		return false
+	}
+}
+
+func (r *ReplayFactory) frameDelivered() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.delivered++
+	if r.delivered == len(r.frames) {
+		close(r.done)
+	}
+}
+
+// replayAsync replays the received frames of one recorded connection
+type replayAsync struct {
+	factory    *ReplayFactory
+	conn       int
+	downstream chan []byte
+	kill       chan struct{}
+	quit       chan error
+	lock       sync.Mutex
+	connected  bool
+	closed     bool
+
+	requests map[string][]string // recorded subscription ids by request, not yet sent
+	subIds   map[string]string   // recorded subscription id -> sent, empty until sent
+	matched  chan struct{}       // closed and replaced when a request is sent
+}
+
+func (a *replayAsync) Connect() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return fmt.Errorf("replay connection closed")
+	}
+	if !a.connected {
+		a.connected = true
+		go a.replay(a.factory.started())
+	}
+	return nil
+}
+
+// replay delivers the frames of the connection until all are delivered or the
+// connection is closed
+func (a *replayAsync) replay(start time.Time) {
+	defer close(a.downstream)
+	for i, f := range a.factory.frames {
+		if f.Conn != a.conn {
+			continue
+		}
+		if !a.factory.wait(i, start, a.kill) {
+			return
+		}
+		data, ok := a.withSentSubId([]byte(f.Data))
+		if !ok {
+			return
+		}
+		select {
+		case a.downstream <- data:
+			a.factory.frameDelivered()
+		case <-a.kill:
+			return
+		}
+	}
+	<-a.kill
+}
+
+func (a *replayAsync) Send(ctx context.Context, msg interface{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.kill:
+		return fmt.Errorf("replay connection closed")
+	default:
+	}
+	req, ok := msg.(*SubscriptionRequest)
+	if !ok {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	key := replayKey(req)
+	if recorded := a.requests[key]; len(recorded) > 0 {
+		a.subIds[recorded[0]] = req.SubID
+		a.requests[key] = recorded[1:]
+		close(a.matched)
+		a.matched = make(chan struct{})
+	}
+	return nil
+}
+
+// withSentSubId replaces the recorded subscription id of an event by the id of
+// the request sent by the client, waiting for the request if necessary.
+// Returns false if the connection is closed while waiting.
+func (a *replayAsync) withSentSubId(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return data, true
+	}
+	ev := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if dec.Decode(&ev) != nil {
+		return data, true
+	}
+	recorded, _ := ev["subId"].(string)
+	for {
+		a.lock.Lock()
+		subId, ok := a.subIds[recorded]
+		matched := a.matched
+		a.lock.Unlock()
+		if !ok {
+			return data, true
+		}
+		if subId != "" {
+			ev["subId"] = subId
+			replaced, err := json.Marshal(ev)
+			if err != nil {
+				return data, true
+			}
+			return replaced, true
+		}
+		select {
+		case <-matched:
+		case <-a.kill:
+			return nil, false
+		}
+	}
+}
+
+func (a *replayAsync) Listen() <-chan []byte {
+	return a.downstream
+}
+
+func (a *replayAsync) Done() <-chan error {
+	return a.quit
+}
+
+func (a *replayAsync) Close() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return
+	}
+	a.closed = true
+	close(a.kill)
+	if !a.connected {
+		close(a.downstream)
+	}
+	a.quit <- fmt.Errorf("replay connection Close called")
+	close(a.quit)
+}
@@ -0,0 +1,159 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vx416/bitfinex-api-go/pkg/models/ticker"
+)
+
+const replayTick = `[5,[14957,68.17328796,14958,55.29588132,-659,-0.0422,14971,53723.08813995,16494,14454]]`
+
+// tickerServer answers ticker subscriptions with a single tick and
+// acknowledges unsubscribes
+func tickerServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.Nil(t, err)
+		defer conn.Close()
+		require.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"info","version":2}`)))
+		for {
+			req := &SubscriptionRequest{}
+			if err := conn.ReadJSON(req); err != nil {
+				return
+			}
+			if req.Event == "unsubscribe" {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"unsubscribed","status":"OK","chanId":5}`)); err != nil {
+					return
+				}
+				continue
+			}
+			subscribed := fmt.Sprintf(`{"event":"subscribed","channel":"ticker","chanId":5,"symbol":"%s","subId":"%s","pair":"BTCUSD"}`, req.Symbol, req.SubID)
+			require.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(subscribed)))
+			require.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(replayTick)))
+		}
+	}))
+}
+
+// nextEvent returns the next event of the given type, skipping others
+func nextEvent(t *testing.T, events <-chan interface{}, match func(interface{}) bool) interface{} {
+	timeout := time.After(time.Second * 2)
+	for {
+		select {
+		case ev := <-events:
+			if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+			return nil
+		}
+	}
+}
+
+type fixedNonce struct {
+	n int
+}
+
+func (f *fixedNonce) GetNonce() string {
+	f.n++
+	return fmt.Sprintf("replay%d", f.n)
+}
+
+func isSubscribed(ev interface{}) bool {
+	_, ok := ev.(*SubscribeEvent)
+	return ok
+}
+
+func isTick(ev interface{}) bool {
+	_, ok := ev.(*ticker.Ticker)
+	return ok
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := tickerServer(t)
+	defer srv.Close()
+
+	// record a session
+	var recording bytes.Buffer
+	p := NewDefaultParameters()
+	p.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	p.Recorder = NewRecorder(&recording)
+	rec := NewWithParams(p)
+	require.Nil(t, rec.Connect())
+	recordedSubId, err := rec.SubscribeTicker(context.Background(), "tBTCUSD")
+	require.Nil(t, err)
+	nextEvent(t, rec.Listen(), isTick)
+	rec.Close()
+	require.Nil(t, p.Recorder.Err())
+
+	frames, err := ReadFrames(&recording)
+	require.Nil(t, err)
+	require.Len(t, frames, 4)
+	for _, f := range frames {
+		assert.Equal(t, SocketId(0), f.SocketId)
+		assert.Equal(t, 0, f.Conn)
+		if f.Direction == FrameOut {
+			assert.Contains(t, f.Data, recordedSubId)
+		} else {
+			assert.Equal(t, FrameIn, f.Direction)
+		}
+	}
+
+	t.Run("replays without delays", func(t *testing.T) {
+		factory := NewReplayFactory(frames).WithSpeed(0)
+		ws := NewWithAsyncFactoryNonce(factory, &fixedNonce{})
+		require.Nil(t, ws.Connect())
+		defer ws.Close()
+
+		subId, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+		require.Nil(t, err)
+		assert.Equal(t, "replay1", subId)
+		sub := nextEvent(t, ws.Listen(), isSubscribed).(*SubscribeEvent)
+		assert.Equal(t, subId, sub.SubID)
+		tick := nextEvent(t, ws.Listen(), isTick).(*ticker.Ticker)
+		assert.Equal(t, "tBTCUSD", tick.Symbol)
+		assert.Equal(t, float64(14971), tick.LastPrice)
+
+		select {
+		case <-factory.Done():
+		case <-time.After(time.Second):
+			t.Fatal("replay did not complete")
+		}
+	})
+
+	t.Run("replays step by step", func(t *testing.T) {
+		factory := NewReplayFactory(frames).Stepped()
+		ws := NewWithAsyncFactoryNonce(factory, &fixedNonce{})
+		require.Nil(t, ws.Connect())
+		defer ws.Close()
+		_, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+		require.Nil(t, err)
+
+		assert.True(t, factory.Step())
+		assert.True(t, factory.Step())
+		nextEvent(t, ws.Listen(), isSubscribed)
+		nextEvent(t, ws.Listen(), func(ev interface{}) bool {
+			_, ok := ev.(*SubscriptionActivated)
+			return ok
+		})
+		select {
+		case ev := <-ws.Listen():
+			t.Fatalf("unexpected event before step: %#v", ev)
+		case <-time.After(time.Millisecond * 100):
+		}
+		assert.True(t, factory.Step())
+		nextEvent(t, ws.Listen(), isTick)
+		assert.False(t, factory.Step())
+	})
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SequenceRecovery selects the action taken when a sequence gap is detected.
+type SequenceRecovery int
+
+const (
+	// SequenceRecoveryEvent only publishes a SequenceGap event.
+	SequenceRecoveryEvent SequenceRecovery = iota
+	// SequenceRecoveryResubscribe resubscribes all public channels of the
+	// connection. Gaps in the authenticated sequence reconnect instead.
+	SequenceRecoveryResubscribe
+	// SequenceRecoveryReconnect reconnects the connection.
+	SequenceRecoveryReconnect
+)
+
+// SequenceGap is published when a message does not carry the next sequence
+// number of its connection. A Received number lower than Expected means the
+// message was duplicated or delivered out of order.
+type SequenceGap struct {
+	SocketId SocketId
+	Private  bool // gap in the authenticated channel sequence
+	Expected int64
+	Received int64
+}
+
+func (g *SequenceGap) OutOfOrder() bool {
+	return g.Received < g.Expected
+}
+
+// next validates a sequence number against the last one seen, skipping ahead
+// on gaps and ignoring messages delivered out of order.
+func nextSequence(last *int64, seq int64) (int64, bool) {
+	expected := *last + 1
+	if *last == 0 || seq == expected {
+		*last = seq
+		return expected, true
+	}
+	if seq > expected {
+		*last = seq
+	}
+	return expected, false
+}
+
+// checkSequence detects gaps in the sequence numbers of a connection and
+// applies the configured SequenceRecovery.
+func (c *Client) checkSequence(socket *Socket, sq *messageTrailer) {
+	if sq == nil || sq.seq == 0 {
+		return
+	}
+	gaps := make([]*SequenceGap, 0)
+	if expected, ok := nextSequence(&socket.conn.seq, sq.seq); !ok {
+		gaps = append(gaps, &SequenceGap{SocketId: socket.Id, Expected: expected, Received: sq.seq})
+	}
+	if sq.authSeq != 0 {
+		if expected, ok := nextSequence(&socket.conn.authSeq, sq.authSeq); !ok {
+			gaps = append(gaps, &SequenceGap{SocketId: socket.Id, Private: true, Expected: expected, Received: sq.authSeq})
+		}
+	}
+	for _, gap := range gaps {
+		c.socketLog(socket.Id).Warningf("sequence gap: expected %d but got %d (private=%t)", gap.Expected, gap.Received, gap.Private)
+		c.recordSequenceGap(gap)
+		c.publish(gap)
+	}
+	if len(gaps) == 0 {
+		return
+	}
+	switch c.parameters.SequenceRecovery {
+	case SequenceRecoveryResubscribe:
+		if gaps[len(gaps)-1].Private {
+			c.restartSocket(socket, fmt.Errorf("authenticated sequence gap"))
+			return
+		}
+		c.resubscribeSocket(socket)
+	case SequenceRecoveryReconnect:
+		c.restartSocket(socket, fmt.Errorf("sequence gap"))
+	}
+}
+
+// resubscribeSocket drops and recreates all public subscriptions of a connection
+func (c *Client) resubscribeSocket(socket *Socket) {
+	set, err := c.subscriptions.lookupBySocketId(socket.Id)
+	if err != nil {
+		return
+	}
+	for _, sub := range *set {
+		if !sub.Public || c.subscriptions.isPending(sub) || !c.subscriptions.startResync(sub) {
+			continue
+		}
+		if err := c.sendUnsubscribeMessage(context.Background(), sub); err != nil {
+			c.subLog(sub).Warningf("could not unsubscribe %s: %s", sub.Request.String(), err.Error())
+			continue
+		}
+		newReq := *sub.Request
+		newReq.SubID = c.nonce.GetNonce() // generate new subID
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		if _, err := c.subscribeBySocket(ctx, socket, &newReq); err != nil {
+			c.socketLog(socket.Id).Warningf("could not resubscribe %s: %s", newReq.String(), err.Error())
+		}
+		cancel()
+	}
+}
+
+// restartSocket closes the connection and reconnects it in the background
+func (c *Client) restartSocket(socket *Socket, reason error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !socket.IsConnected || c.terminal {
+		return
+	}
+	c.socketLog(socket.Id).Infof("restarting socket connection")
+	socket.IsConnected = false
+	c.waitGroup.Add(1)
+	go func() {
+		defer c.waitGroup.Done()
+		c.closeAsyncAndWait(socket, c.parameters.ShutdownTimeout)
+		if err := c.reconnect(socket, reason); err != nil {
+			c.log.Warningf("socket disconnect: %s", err.Error())
+		}
+	}()
+}
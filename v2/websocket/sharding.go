@@ -0,0 +1,411 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/book"
+)
+
+// SubscriptionWeight estimates the message rate of a subscription: raw books
+// weigh the most, followed by aggregated books, trades and all other channels.
+func SubscriptionWeight(req *SubscriptionRequest) int {
+	switch req.Channel {
+	case ChanBook:
+		if book.IsRawBook(req.Precision) {
+			return 8
+		}
+		return 4
+	case ChanTrades:
+		return 2
+	}
+	return 1
+}
+
+func isRawBookRequest(req *SubscriptionRequest) bool {
+	return req.Channel == ChanBook && book.IsRawBook(req.Precision)
+}
+
+// SocketLoad describes the public subscriptions carried by a connection.
+type SocketLoad struct {
+	SocketId      SocketId
+	Subscriptions []*SubscriptionRequest
+	Weight        int
+	Capacity      int // free channels
+}
+
+func (l *SocketLoad) add(req *SubscriptionRequest) {
+	l.Subscriptions = append(l.Subscriptions, req)
+	l.Weight += SubscriptionWeight(req)
+	l.Capacity--
+}
+
+func (l *SocketLoad) remove(req *SubscriptionRequest) {
+	for i, r := range l.Subscriptions {
+		if r == req {
+			l.Subscriptions = append(l.Subscriptions[:i:i], l.Subscriptions[i+1:]...)
+			l.Weight -= SubscriptionWeight(req)
+			l.Capacity++
+			return
+		}
+	}
+}
+
+// RawBooks returns the number of raw book subscriptions on the connection.
+func (l SocketLoad) RawBooks() int {
+	n := 0
+	for _, req := range l.Subscriptions {
+		if isRawBookRequest(req) {
+			n++
+		}
+	}
+	return n
+}
+
+// ShardingPolicy assigns subscriptions to connections. SelectSocket is given
+// the load of every connection ordered by socket id and returns the connection
+// for the request, or false to open a new connection.
+type ShardingPolicy interface {
+	SelectSocket(req *SubscriptionRequest, sockets []SocketLoad) (SocketId, bool)
+}
+
+// MostAvailable picks the connection with the most free channels. This is the
+// default policy.
+type MostAvailable struct{}
+
+func (MostAvailable) SelectSocket(req *SubscriptionRequest, sockets []SocketLoad) (SocketId, bool) {
+	best := -1
+	for i, l := range sockets {
+		if l.Capacity > 0 && (best < 0 || l.Capacity > sockets[best].Capacity) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return sockets[best].SocketId, true
+}
+
+// ChannelWeight picks the connection with the lowest SubscriptionWeight sum, so
+// heavy book feeds are spread across connections.
+type ChannelWeight struct{}
+
+func (ChannelWeight) SelectSocket(req *SubscriptionRequest, sockets []SocketLoad) (SocketId, bool) {
+	best := -1
+	for i, l := range sockets {
+		if l.Capacity > 0 && (best < 0 || l.Weight < sockets[best].Weight) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return sockets[best].SocketId, true
+}
+
+// SymbolHash keeps all subscriptions of a symbol on the same connection by
+// hashing the symbol onto one of Shards connections. Connections are opened
+// until there is one per shard, a full shard falls back to ChannelWeight.
+type SymbolHash struct {
+	Shards int
+}
+
+func (s SymbolHash) SelectSocket(req *SubscriptionRequest, sockets []SocketLoad) (SocketId, bool) {
+	if s.Shards <= 0 {
+		return ChannelWeight{}.SelectSocket(req, sockets)
+	}
+	key := req.Symbol
+	if key == "" {
+		key = req.Key
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := int(h.Sum32() % uint32(s.Shards))
+	if shard >= len(sockets) {
+		return 0, false
+	}
+	if sockets[shard].Capacity > 0 {
+		return sockets[shard].SocketId, true
+	}
+	return ChannelWeight{}.SelectSocket(req, sockets)
+}
+
+// DedicatedRawBooks gives every raw book a connection of its own and assigns
+// all other subscriptions with Fallback, ChannelWeight if nil, to the
+// remaining connections.
+type DedicatedRawBooks struct {
+	Fallback ShardingPolicy
+}
+
+func (d DedicatedRawBooks) SelectSocket(req *SubscriptionRequest, sockets []SocketLoad) (SocketId, bool) {
+	if isRawBookRequest(req) {
+		for _, l := range sockets {
+			if len(l.Subscriptions) == 0 && l.Capacity > 0 {
+				return l.SocketId, true
+			}
+		}
+		return 0, false
+	}
+	shared := make([]SocketLoad, 0, len(sockets))
+	for _, l := range sockets {
+		if l.RawBooks() == 0 {
+			shared = append(shared, l)
+		}
+	}
+	fallback := d.Fallback
+	if fallback == nil {
+		fallback = ChannelWeight{}
+	}
+	return fallback.SelectSocket(req, shared)
+}
+
+// SubscriptionMigrated is published when Rebalance moved a subscription to
+// another connection, the subscription continues with NewSubID.
+type SubscriptionMigrated struct {
+	OldSubID string
+	NewSubID string
+	From     SocketId
+	To       SocketId
+}
+
+// maximum number of connections opened for a single subscription before the
+// sharding policy is considered to never select one
+const maxPolicyConnections = 20
+
+// migration replaces a subscription with a new one on another connection
+type migration struct {
+	from *subscription
+	done chan struct{}
+}
+
+func (c *Client) shardingPolicy() ShardingPolicy {
+	if c.parameters.ShardingPolicy != nil {
+		return c.parameters.ShardingPolicy
+	}
+	return MostAvailable{}
+}
+
+// socketLoads returns the load of all connections ordered by socket id
+func (c *Client) socketLoads() []SocketLoad {
+	c.mtx.RLock()
+	ids := make([]SocketId, 0, len(c.sockets))
+	for id := range c.sockets {
+		ids = append(ids, id)
+	}
+	c.mtx.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	loads := make([]SocketLoad, len(ids))
+	for i, id := range ids {
+		loads[i] = SocketLoad{SocketId: id, Capacity: c.getAvailableSocketCapacity(id)}
+		set, err := c.subscriptions.lookupBySocketId(id)
+		if err != nil {
+			continue
+		}
+		for _, sub := range *set {
+			if sub.Public && !c.subscriptions.isStale(sub) {
+				loads[i].Subscriptions = append(loads[i].Subscriptions, sub.Request)
+				loads[i].Weight += SubscriptionWeight(sub.Request)
+			}
+		}
+	}
+	return loads
+}
+
+// selectSocket returns the connection for a new subscription, opening new
+// connections until the sharding policy selects one
+func (c *Client) selectSocket(req *SubscriptionRequest) (*Socket, error) {
+	if c.getTotalAvailableSocketCapacity() <= 1 {
+		err := c.StartNewConnection()
+		if err != nil {
+			return nil, err
+		}
+	}
+	policy := c.shardingPolicy()
+	for opened := 0; ; opened++ {
+		socketId, ok := policy.SelectSocket(req, c.socketLoads())
+		if ok {
+			return c.socketById(socketId)
+		}
+		if opened == maxPolicyConnections {
+			return nil, fmt.Errorf("sharding policy selected no connection for %s after opening %d connections", req.String(), opened)
+		}
+		if _, err := c.startConnection(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type subscriptionMove struct {
+	sub *subscription
+	to  SocketId
+}
+
+// planRebalance assigns the subscriptions again, heaviest first, each with the
+// other subscriptions in place so that balanced connections stay untouched.
+// Connections the policy asks for are opened with open and appended to loads.
+func planRebalance(policy ShardingPolicy, loads []SocketLoad, subs []*subscription, open func() (SocketLoad, error)) ([]subscriptionMove, []SocketLoad, error) {
+	sort.SliceStable(subs, func(i, j int) bool {
+		wi, wj := SubscriptionWeight(subs[i].Request), SubscriptionWeight(subs[j].Request)
+		if wi != wj {
+			return wi > wj
+		}
+		return subs[i].SubID() < subs[j].SubID()
+	})
+	index := func(id SocketId) int {
+		for i, l := range loads {
+			if l.SocketId == id {
+				return i
+			}
+		}
+		return -1
+	}
+	moves := make([]subscriptionMove, 0)
+	for _, sub := range subs {
+		if i := index(sub.SocketId); i >= 0 {
+			loads[i].remove(sub.Request)
+		}
+		to, ok := policy.SelectSocket(sub.Request, loads)
+		for opened := 0; !ok; opened++ {
+			if opened == maxPolicyConnections {
+				return moves, loads, fmt.Errorf("sharding policy selected no connection for %s after opening %d connections", sub.Request.String(), opened)
+			}
+			load, err := open()
+			if err != nil {
+				return moves, loads, err
+			}
+			loads = append(loads, load)
+			to, ok = policy.SelectSocket(sub.Request, loads)
+		}
+		if i := index(to); i >= 0 {
+			loads[i].add(sub.Request)
+		}
+		if to != sub.SocketId {
+			moves = append(moves, subscriptionMove{sub: sub, to: to})
+		}
+	}
+	return moves, loads, nil
+}
+
+// Rebalance moves public subscriptions between connections to match the
+// sharding policy, opening new connections if the policy asks for them. A
+// subscription is moved by subscribing on the new connection first, the old
+// subscription is dropped once the first message of the new one arrives, so
+// managed books are rebuilt from the new snapshot without a gap. Every move
+// publishes a SubscriptionMigrated event. Rebalance returns once all moves are
+// complete or the context is done.
+func (c *Client) Rebalance(ctx context.Context) error {
+	if err := c.checkMaintenance(); err != nil {
+		return err
+	}
+	subs := c.subscriptions.lookupByRequest(isPublic)
+	movable := make([]*subscription, 0, len(subs))
+	for _, sub := range subs {
+		if !c.subscriptions.isPending(sub) && !c.subscriptions.isResyncing(sub) && !c.subscriptions.isMigrating(sub) {
+			movable = append(movable, sub)
+		}
+	}
+	open := func() (SocketLoad, error) {
+		socketId, err := c.startConnection()
+		if err != nil {
+			return SocketLoad{}, err
+		}
+		return SocketLoad{SocketId: socketId, Capacity: c.getAvailableSocketCapacity(socketId)}, nil
+	}
+	moves, _, err := planRebalance(c.shardingPolicy(), c.socketLoads(), movable, open)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]*migration, 0, len(moves))
+	for _, move := range moves {
+		m, err := c.migrate(ctx, move.sub, move.to)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, m)
+	}
+	for _, m := range pending {
+		select {
+		case <-m.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// migrate subscribes on the target connection with a new subscription which
+// replaces sub once its first message arrives
+func (c *Client) migrate(ctx context.Context, sub *subscription, to SocketId) (*migration, error) {
+	socket, err := c.socketById(to)
+	if err != nil {
+		return nil, err
+	}
+	newReq := *sub.Request
+	newReq.SubID = c.nonce.GetNonce() // generate new subID
+	m := &migration{from: sub, done: make(chan struct{})}
+	c.subscriptions.addReplacement(socket.Id, &newReq, m)
+	c.recordSubscriptions(socket.Id)
+	c.subLog(sub).Infof("moving %s from socket (id=%d) to socket (id=%d)", sub.Request.String(), sub.SocketId, to)
+	if err := socket.Asynchronous.Send(ctx, &newReq); err != nil {
+		return nil, fmt.Errorf("could not move %s: %s", sub.Request.String(), err.Error())
+	}
+	return m, nil
+}
+
+// takeOver retires the subscription replaced by sub, called with the first
+// message of sub. The returned migration is completed once the message is
+// handled, the messages of the old subscription are dropped from now on.
+func (c *Client) takeOver(sub *subscription) *migration {
+	return c.subscriptions.takeMigration(sub)
+}
+
+// addReplacement tracks a subscription replacing another one on another socket
+func (s *subscriptions) addReplacement(socketId SocketId, req *SubscriptionRequest, m *migration) *subscription {
+	sub := s.add(socketId, req)
+	s.lock.Lock()
+	sub.migration = m
+	s.lock.Unlock()
+	return sub
+}
+
+func (s *subscriptions) takeMigration(sub *subscription) *migration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m := sub.migration
+	if m != nil {
+		sub.migration = nil
+		m.from.migrated = true
+	}
+	return m
+}
+
+// isMigrated reports whether the subscription was replaced by another one
+func (s *subscriptions) isMigrated(sub *subscription) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return sub.migrated
+}
+
+// isMigrating reports whether the subscription is being replaced or replaces another one
+func (s *subscriptions) isMigrating(sub *subscription) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return sub.migrated || sub.migration != nil
+}
+
+func (c *Client) completeMigration(sub *subscription, m *migration) {
+	if err := c.sendUnsubscribeMessage(context.Background(), m.from); err != nil {
+		c.subLog(m.from).Warningf("could not unsubscribe %s: %s", m.from.Request.String(), err.Error())
+	}
+	c.publish(&SubscriptionMigrated{
+		OldSubID: m.from.SubID(),
+		NewSubID: sub.SubID(),
+		From:     m.from.SocketId,
+		To:       sub.SocketId,
+	})
+	close(m.done)
+}
@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bookReq(symbol, prec string) *SubscriptionRequest {
+	return &SubscriptionRequest{SubID: symbol + prec, Channel: ChanBook, Symbol: symbol, Precision: prec}
+}
+
+func loadOf(id SocketId, reqs ...*SubscriptionRequest) SocketLoad {
+	l := SocketLoad{SocketId: id, Capacity: 25}
+	for _, req := range reqs {
+		l.add(req)
+	}
+	return l
+}
+
+func TestShardingPolicies(t *testing.T) {
+	trades := &SubscriptionRequest{SubID: "trades", Channel: ChanTrades, Symbol: "tBTCUSD"}
+
+	t.Run("most available", func(t *testing.T) {
+		sockets := []SocketLoad{loadOf(0, bookReq("tBTCUSD", "P0"), bookReq("tETHUSD", "P0")), loadOf(1, trades, trades, trades)}
+		id, ok := MostAvailable{}.SelectSocket(trades, sockets)
+		assert.True(t, ok)
+		assert.Equal(t, SocketId(0), id)
+
+		sockets[0].Capacity = 0
+		sockets[1].Capacity = 0
+		_, ok = MostAvailable{}.SelectSocket(trades, sockets)
+		assert.False(t, ok)
+	})
+
+	t.Run("channel weight", func(t *testing.T) {
+		sockets := []SocketLoad{loadOf(0, bookReq("tBTCUSD", "P0"), bookReq("tETHUSD", "P0")), loadOf(1, trades, trades, trades)}
+		id, ok := ChannelWeight{}.SelectSocket(trades, sockets)
+		assert.True(t, ok)
+		assert.Equal(t, SocketId(1), id)
+	})
+
+	t.Run("symbol hash", func(t *testing.T) {
+		policy := SymbolHash{Shards: 3}
+		var sockets []SocketLoad
+		// connections are opened until the shard of the symbol exists
+		for {
+			id, ok := policy.SelectSocket(trades, sockets)
+			if ok {
+				// every subscription of the symbol lands on the same shard
+				same, _ := policy.SelectSocket(bookReq("tBTCUSD", "P0"), sockets)
+				assert.Equal(t, id, same)
+				break
+			}
+			sockets = append(sockets, loadOf(SocketId(len(sockets))))
+			assert.True(t, len(sockets) <= 3)
+		}
+	})
+
+	t.Run("dedicated raw books", func(t *testing.T) {
+		policy := DedicatedRawBooks{}
+		sockets := []SocketLoad{loadOf(0, trades), loadOf(1, bookReq("tETHUSD", "R0"))}
+		_, ok := policy.SelectSocket(bookReq("tBTCUSD", "R0"), sockets)
+		assert.False(t, ok)
+
+		sockets = append(sockets, loadOf(2))
+		id, ok := policy.SelectSocket(bookReq("tBTCUSD", "R0"), sockets)
+		assert.True(t, ok)
+		assert.Equal(t, SocketId(2), id)
+
+		// other subscriptions stay off raw book connections
+		sockets[0].Capacity = 0
+		sockets = sockets[:2]
+		_, ok = policy.SelectSocket(trades, sockets)
+		assert.False(t, ok)
+	})
+}
+
+func TestPlanRebalance(t *testing.T) {
+	subs := []*subscription{
+		newSubscription(0, bookReq("tBTCUSD", "P0")),
+		newSubscription(0, bookReq("tETHUSD", "P0")),
+		newSubscription(0, bookReq("tLTCUSD", "P0")),
+		newSubscription(0, bookReq("tXRPUSD", "P0")),
+	}
+	reqs := make([]*SubscriptionRequest, len(subs))
+	for i, sub := range subs {
+		reqs[i] = sub.Request
+	}
+
+	t.Run("spreads lopsided load", func(t *testing.T) {
+		loads := []SocketLoad{loadOf(0, reqs...), loadOf(1)}
+		moves, planned, err := planRebalance(ChannelWeight{}, loads, append([]*subscription{}, subs...), nil)
+		assert.Nil(t, err)
+		assert.Len(t, moves, 2)
+		assert.Len(t, planned, 2)
+		assert.Equal(t, planned[0].Weight, planned[1].Weight)
+		for _, move := range moves {
+			assert.Equal(t, SocketId(1), move.to)
+		}
+	})
+
+	t.Run("keeps balanced load", func(t *testing.T) {
+		balanced := make([]*subscription, len(subs))
+		for i, sub := range subs {
+			balanced[i] = newSubscription(SocketId(i%2), sub.Request)
+		}
+		loads := []SocketLoad{loadOf(0, reqs[0], reqs[2]), loadOf(1, reqs[1], reqs[3])}
+		moves, _, err := planRebalance(ChannelWeight{}, loads, balanced, nil)
+		assert.Nil(t, err)
+		assert.Len(t, moves, 0)
+	})
+
+	t.Run("opens connections", func(t *testing.T) {
+		raw := []*subscription{newSubscription(0, bookReq("tBTCUSD", "R0")), newSubscription(0, bookReq("tETHUSD", "R0"))}
+		loads := []SocketLoad{loadOf(0, raw[0].Request, raw[1].Request)}
+		// socket ids are not contiguous
+		open := func() (SocketLoad, error) {
+			return SocketLoad{SocketId: 7, Capacity: 25}, nil
+		}
+		moves, planned, err := planRebalance(DedicatedRawBooks{}, loads, raw, open)
+		assert.Nil(t, err)
+		assert.Len(t, moves, 1)
+		assert.Len(t, planned, 2)
+		assert.Equal(t, SocketId(7), moves[0].to)
+	})
+}
+
+func TestMigratedBookUpdates(t *testing.T) {
+	p := NewDefaultParameters()
+	p.ManageOrderbook = true
+	c := NewWithParams(p)
+	defer c.Close()
+	f := c.factories[ChanBook].(*BookFactory)
+
+	old := c.subscriptions.add(0, bookReq("tBTCUSD", "P0"))
+	_, err := f.BuildSnapshot(old, [][]interface{}{{9000.0, 1.0, 1.0}, {9010.0, 1.0, -1.0}}, []byte(`[5,[[9000,1,1],[9010,1,-1]]]`))
+	require.Nil(t, err)
+
+	req := *old.Request
+	req.SubID = "moved"
+	sub := c.subscriptions.addReplacement(1, &req, &migration{from: old, done: make(chan struct{})})
+
+	// an update of the old socket which passed the migration check before the
+	// takeover must not be applied after the new snapshot
+	require.NotNil(t, c.takeOver(sub))
+	_, err = f.BuildSnapshot(sub, [][]interface{}{{9001.0, 1.0, 1.0}, {9011.0, 1.0, -1.0}}, []byte(`[5,[[9001,1,1],[9011,1,-1]]]`))
+	require.Nil(t, err)
+	_, err = f.Build(old, "", []interface{}{8990.0, 1.0, 2.0}, []byte(`[5,[8990,1,2]]`))
+	require.Nil(t, err)
+	_, err = f.BuildBulk(old, [][]interface{}{{8980.0, 1.0, 2.0}}, []byte(`[5,[[8980,1,2]]]`))
+	require.Nil(t, err)
+
+	ob := c.orderbooks["tBTCUSD"]
+	require.Len(t, ob.Bids(), 1)
+	assert.Equal(t, 9001.0, ob.Bids()[0].Price)
+
+	// updates of the new subscription are applied
+	_, err = f.Build(sub, "", []interface{}{8990.0, 1.0, 2.0}, []byte(`[5,[8990,1,2]]`))
+	require.Nil(t, err)
+	assert.Len(t, ob.Bids(), 2)
+}
@@ -2,7 +2,7 @@ package websocket
 
 import (
 	"fmt"
-	"github.com/op/go-logging"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +19,8 @@ type SubscriptionRequest struct {
 	AuthNonce   string   `json:"authNonce,omitempty"`
 	Filter      []string `json:"filter,omitempty"`
 	DMS         int      `json:"dms,omitempty"` // dead man switch
+	Calc        int      `json:"calc,omitempty"`
+	Token       string   `json:"token,omitempty"`
 
 	// unauthenticated
 	Channel   string `json:"channel,omitempty"`
@@ -60,10 +62,16 @@ type subscription struct {
 	SocketId   SocketId
 	pending    bool
 	Public     bool
+	resyncing  bool // book out of sync, being unsubscribed
+	snapshot   bool // first snapshot received
+	migrated   bool // replaced by a subscription on another socket
+	migration  *migration // replaces another subscription once the first message arrives
 
 	Request    *SubscriptionRequest
 
 	hbDeadline time.Time
+	lastHeartbeat time.Time // last message or heartbeat of the channel
+	messages   int64
 }
 
 func isPublic(request *SubscriptionRequest) bool {
@@ -100,13 +108,41 @@ func (s subscription) Pending() bool {
 	return s.pending
 }
 
-func newSubscriptions(heartbeatTimeout time.Duration, log *logging.Logger) *subscriptions {
+// isResyncing reports whether the subscription is being dropped to rebuild its data
+func (s *subscriptions) isResyncing(sub *subscription) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return sub.resyncing
+}
+
+// startResync marks the subscription as being dropped to rebuild its data, it
+// reports false if it already is
+func (s *subscriptions) startResync(sub *subscription) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sub.resyncing {
+		return false
+	}
+	sub.resyncing = true
+	return true
+}
+
+// isStale reports whether the messages of the subscription must no longer
+// update managed books, as it is being resynced or was replaced
+func (s *subscriptions) isStale(sub *subscription) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return sub.resyncing || sub.migrated
+}
+
+func newSubscriptions(heartbeatTimeout time.Duration, log logger.Logger) *subscriptions {
 	subs := &subscriptions{
 		subsBySubID:  make(map[string]*subscription),
 		subsByChanID: make(map[int64]*subscription),
 		subsBySocketId: make(map[SocketId]SubscriptionSet),
 		hbTimeout:    heartbeatTimeout,
 		hbShutdown:   make(chan struct{}),
+		hbDone:       make(chan struct{}),
 		hbDisconnect: make(chan HeartbeatDisconnect),
 		hbSleep:      heartbeatTimeout / time.Duration(4),
 		log:          log,
@@ -124,7 +160,7 @@ type heartbeat struct {
 
 type subscriptions struct {
 	lock         *sync.RWMutex
-	log          *logging.Logger
+	log          logger.Logger
 
 	subsBySocketId map[SocketId]SubscriptionSet // subscripts map indexed by socket id
 	subsBySubID  map[string]*subscription // subscription map indexed by subscription ID
@@ -135,6 +171,7 @@ type subscriptions struct {
 	hbTimeout    time.Duration
 	hbSleep      time.Duration
 	hbShutdown   chan struct{}
+	hbDone       chan struct{} // closed when the heartbeat sweep stopped
 }
 
 // SubscriptionSet is a typed version of an array of subscription pointers, intended to meet the sortable interface.
@@ -182,7 +219,9 @@ func (s *subscriptions) heartbeat(chanID int64) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	if sub, ok := s.subsByChanID[chanID]; ok {
-		sub.hbDeadline = time.Now().Add(s.hbTimeout)
+		sub.lastHeartbeat = time.Now()
+		sub.hbDeadline = sub.lastHeartbeat.Add(s.hbTimeout)
+		sub.messages++
 	}
 }
 
@@ -205,26 +244,38 @@ func (s *subscriptions) sweep(exp time.Time) {
 	}
 	s.lock.RUnlock()
 	for _, dis := range disconnects {
-		s.hbDisconnect <- dis
+		select {
+		case s.hbDisconnect <- dis:
+		case <-s.hbShutdown:
+			return
+		}
 	}
 }
 
 func (s *subscriptions) control() {
+	defer close(s.hbDone)
+	interval := s.hbSleep
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-s.hbShutdown:
 			return
-		default:
+		case now := <-ticker.C:
+			s.sweep(now)
 		}
-		s.sweep(time.Now())
-		time.Sleep(s.hbSleep)
 	}
 }
 
-// Close is terminal. Do not call heartbeat after close.
+// Close is terminal and waits for the heartbeat sweep to stop. Do not call
+// heartbeat after close.
 func (s *subscriptions) Close() {
 	s.ResetAll()
 	close(s.hbShutdown)
+	<-s.hbDone
 }
 
 
@@ -290,6 +341,29 @@ func (s *subscriptions) removeByChannelID(chanID int64) error {
 	return nil
 }
 
+// removeBySocketChannelID removes the subscription of a channel on the given
+// socket, channel IDs are only unique per socket
+func (s *subscriptions) removeBySocketChannelID(chanID int64, socketId SocketId) (*subscription, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	set, ok := s.subsBySocketId[socketId]
+	if !ok {
+		return nil, fmt.Errorf("could not find channel ID %d on socket %d", chanID, socketId)
+	}
+	for _, sub := range set {
+		if sub.ChanID != chanID {
+			continue
+		}
+		if s.subsByChanID[chanID] == sub {
+			delete(s.subsByChanID, chanID)
+		}
+		delete(s.subsBySubID, sub.SubID())
+		s.subsBySocketId[socketId] = set.RemoveByChannelId(chanID)
+		return sub, nil
+	}
+	return nil, fmt.Errorf("could not find channel ID %d on socket %d", chanID, socketId)
+}
+
 // nolint:megacheck
 func (s *subscriptions) removeBySubscriptionID(subID string) error {
 	s.lock.Lock()
@@ -314,7 +388,8 @@ func (s *subscriptions) activate(subID string, chanID int64) error {
 
 	if sub, ok := s.subsBySubID[subID]; ok {
 		if chanID != 0 {
-			s.log.Infof("activated subscription %s %s for channel %d", sub.Request.Channel, sub.Request.Symbol, chanID)
+			s.log.With(logger.SocketID(int(sub.SocketId)), logger.ChanID(chanID), logger.SubID(subID), logger.Symbol(sub.Request.Symbol)).
+				Infof("activated subscription %s %s for channel %d", sub.Request.Channel, sub.Request.Symbol, chanID)
 		}
 		sub.pending = false
 		sub.ChanID = chanID
@@ -349,6 +424,19 @@ func (s *subscriptions) lookupBySubscriptionID(subID string) (*subscription, err
 	return nil, fmt.Errorf("could not find subscription ID %s", subID)
 }
 
+// lookupByRequest returns all subscriptions whose request satisfies the given filter
+func (s *subscriptions) lookupByRequest(filter func(*SubscriptionRequest) bool) []*subscription {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	subs := make([]*subscription, 0)
+	for _, sub := range s.subsBySubID {
+		if filter(sub.Request) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
 func (s *subscriptions) lookupBySocketId(socketId SocketId) (*SubscriptionSet, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
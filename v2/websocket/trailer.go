@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vx416/bitfinex-api-go/pkg/models/common"
+)
+
+// Envelope wraps messages delivered on connections with the SEQ_ALL or
+// TIMESTAMP conf flags enabled. AuthSeq is only set for messages on the
+// authenticated channel and Timestamp only with the TIMESTAMP flag.
+type Envelope struct {
+	Message   interface{}
+	SocketId  SocketId
+	Seq       int64
+	AuthSeq   int64
+	Timestamp time.Time
+}
+
+// Sequenced is the name Envelope was introduced with for SEQ_ALL messages.
+//
+// Deprecated: use Envelope, Sequenced is an alias kept for compatibility.
+type Sequenced = Envelope
+
+// LatencyStats summarizes the delay between the server timestamp of messages
+// and their reception, requires the TIMESTAMP conf flag.
+type LatencyStats struct {
+	Samples int64
+	Last    time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+}
+
+type latencyStats struct {
+	lock  sync.Mutex
+	stats LatencyStats
+	total time.Duration
+}
+
+func (l *latencyStats) record(latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	s := &l.stats
+	if s.Samples == 0 || latency < s.Min {
+		s.Min = latency
+	}
+	if latency > s.Max {
+		s.Max = latency
+	}
+	s.Samples++
+	s.Last = latency
+	l.total += latency
+	s.Mean = l.total / time.Duration(s.Samples)
+}
+
+func (l *latencyStats) snapshot() LatencyStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.stats
+}
+
+// connState holds the conf flags, last sequence numbers, latency and health of
+// a connection.
+type connState struct {
+	flags   int
+	seq     int64
+	authSeq int64
+	latency latencyStats
+
+	pings       *pingTracker
+	lastMessage int64 // unix nanos, accessed atomically
+	reconnects  int
+	done        chan struct{} // closed once the connection stops listening
+}
+
+// messageTrailer are the fields appended to a single message by conf flags
+type messageTrailer struct {
+	socketId SocketId
+	seq      int64
+	authSeq  int64
+	ts       time.Time
+}
+
+// wrap returns the message to deliver, msg itself if no flags are enabled
+func (t *messageTrailer) wrap(msg interface{}) interface{} {
+	if t == nil {
+		return msg
+	}
+	return &Envelope{Message: msg, SocketId: t.socketId, Seq: t.seq, AuthSeq: t.authSeq, Timestamp: t.ts}
+}
+
+// trailerIndex returns the index of the first field appended by conf flags:
+// [chanId, data], [chanId, "hb"] or [chanId, "type", data]
+func trailerIndex(raw []interface{}) int {
+	if s, ok := raw[1].(string); ok && s != "hb" {
+		return 3
+	}
+	return 2
+}
+
+// parseTrailer extracts the fields appended to a message by the conf flags of
+// its connection: the sequence number, the authenticated sequence number on
+// private messages and finally the timestamp.
+func parseTrailer(socketId SocketId, flags int, raw []interface{}, private bool) *messageTrailer {
+	if flags&(common.SeqAll|common.Timestamp) == 0 {
+		return nil
+	}
+	fields := make([]int64, 0, 3)
+	for _, f := range raw[trailerIndex(raw):] {
+		n, ok := f.(float64)
+		if !ok {
+			return nil
+		}
+		fields = append(fields, int64(n))
+	}
+	next := func() int64 {
+		if len(fields) == 0 {
+			return 0
+		}
+		n := fields[0]
+		fields = fields[1:]
+		return n
+	}
+	t := &messageTrailer{socketId: socketId}
+	if flags&common.SeqAll != 0 {
+		t.seq = next()
+		// private heartbeats only carry the public sequence
+		if hb, _ := raw[1].(string); private && hb != "hb" {
+			t.authSeq = next()
+		}
+	}
+	if flags&common.Timestamp != 0 {
+		if ts := next(); ts > 0 {
+			t.ts = time.Unix(0, ts*int64(time.Millisecond))
+		}
+	}
+	return t
+}
+
+// hasConnFlag reports whether the conf flag is enabled on the given connection
+func (c *Client) hasConnFlag(socketId SocketId, flag int) bool {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return false
+	}
+	return socket.conn.flags&flag != 0
+}
+
+// recordLatency tracks the delay of messages carrying a server timestamp
+func (c *Client) recordLatency(socket *Socket, t *messageTrailer) {
+	if t == nil || t.ts.IsZero() {
+		return
+	}
+	socket.conn.latency.record(time.Since(t.ts))
+}
+
+// MessageLatency returns the latency statistics of the given connection. This
+// requires ServerTimestamps=True.
+func (c *Client) MessageLatency(socketId SocketId) (LatencyStats, error) {
+	socket, err := c.socketById(socketId)
+	if err != nil {
+		return LatencyStats{}, err
+	}
+	return socket.conn.latency.snapshot(), nil
+}
@@ -5,13 +5,14 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"github.com/op/go-logging"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/vx416/bitfinex-api-go/pkg/logger"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
 )
 
 // size of channel that the websocket writer
@@ -24,7 +25,7 @@ const WS_READ_CAPACITY = 10
 // the keep alive ping
 const KEEP_ALIVE_TIMEOUT = 10
 
-func newWs(baseURL string, logTransport bool, log *logging.Logger) *ws {
+func newWs(baseURL string, logTransport bool, log logger.Logger, sink metrics.Sink) *ws {
 	return &ws{
 		BaseURL:      baseURL,
 		downstream:   make(chan []byte, WS_READ_CAPACITY),
@@ -32,6 +33,7 @@ func newWs(baseURL string, logTransport bool, log *logging.Logger) *ws {
 		kill:         make(chan interface{}),
 		logTransport: logTransport,
 		log:          log,
+		metrics:      sink,
 		lock:         &sync.RWMutex{},
 		createTime:   time.Now(),
 		writeChan:    make(chan []byte, WS_WRITE_CAPACITY),
@@ -45,7 +47,11 @@ type ws struct {
 	TLSSkipVerify bool
 	downstream    chan []byte
 	logTransport  bool
-	log           *logging.Logger
+	log           logger.Logger
+	metrics       metrics.Sink
+	recorder      *Recorder
+	socketId      SocketId
+	conn          int
 	createTime    time.Time
 	writeChan     chan []byte
 
@@ -76,6 +82,9 @@ func (w *ws) Connect() error {
 		return err
 	}
 	w.ws = ws
+	if w.recorder != nil {
+		w.conn = w.recorder.newConn()
+	}
 	go w.listenWriteChannel()
 	go w.listenWs()
 	// Gorilla/go dont natively support keep alive pinging
@@ -85,6 +94,8 @@ func (w *ws) Connect() error {
 	return nil
 }
 
+// keepAlivePinger sends websocket ping frames, round trip times are measured
+// with ping events by the client
 func (w *ws) keepAlivePinger() {
 	for {
 		pingTimer := time.After(time.Second * KEEP_ALIVE_TIMEOUT)
@@ -92,7 +103,14 @@ func (w *ws) keepAlivePinger() {
 		case <-w.kill:
 			return
 		case <-pingTimer:
-			w.writeChan <- []byte("ping")
+			w.lock.RLock()
+			if w.ws != nil {
+				deadline := time.Now().Add(time.Second * KEEP_ALIVE_TIMEOUT)
+				if err := w.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					w.log.Warningf("unable to send keep alive ping: %s", err)
+				}
+			}
+			w.lock.RUnlock()
 		}
 	}
 }
@@ -113,12 +131,20 @@ func (w *ws) Send(ctx context.Context, msg interface{}) error {
 		return fmt.Errorf("websocket connection closed")
 	default:
 	}
-	w.log.Debug("ws->srv: %s", string(bs))
+	if w.logTransport {
+		w.log.Debugf("ws->srv: %s", logger.Redact(string(bs)))
+	}
 	// push request into writer channel
 	w.writeChan <- bs
+	w.recordQueue()
 	return nil
 }
 
+// recordQueue reports the number of messages waiting to be written
+func (w *ws) recordQueue() {
+	w.metrics.SetGauge(metrics.WsWriteQueue, socketLabels(w.socketId), float64(len(w.writeChan)))
+}
+
 func (w *ws) Done() <-chan error {
 	return w.quit
 }
@@ -132,21 +158,23 @@ func (w *ws) listenWriteChannel() {
 		case message := <- w.writeChan:
 			wsWriter, err := w.ws.NextWriter(websocket.TextMessage)
 			if err != nil {
-				w.log.Error("Unable to provision ws connection writer: ", err)
+				w.log.Errorf("Unable to provision ws connection writer: %s", err)
 				w.stop(err)
 				return
 			}
 			_, err = wsWriter.Write(message)
 			if err != nil {
-				w.log.Error("Unable to write to ws: ", err)
+				w.log.Errorf("Unable to write to ws: %s", err)
 				w.stop(err)
 				return
 			}
 			if err := wsWriter.Close(); err != nil {
-				w.log.Error("Unable to close ws connection writer: ", err)
+				w.log.Errorf("Unable to close ws connection writer: %s", err)
 				w.stop(err)
 				return
 			}
+			w.record(FrameOut, message)
+			w.recordQueue()
 		}
 	}
 }
@@ -175,7 +203,10 @@ func (w *ws) listenWs() {
 				w.stop(err)
 				return
 			}
-			w.log.Debugf("srv->ws: %s", string(msg))
+			if w.logTransport {
+				w.log.Debugf("srv->ws: %s", logger.Redact(string(msg)))
+			}
+			w.record(FrameIn, msg)
 			w.lock.RLock()
 			if w.downstream == nil {
 				w.lock.RUnlock()
@@ -201,7 +232,7 @@ func (w *ws) stop(err error) {
 		close(w.downstream)
 		w.downstream = nil
 		if err := w.ws.Close(); err != nil {
-			w.log.Error(fmt.Errorf("error closing websocket: %s", err))
+			w.log.Errorf("error closing websocket: %s", err)
 		}
 		w.ws = nil
 	}
@@ -0,0 +1,35 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vx416/bitfinex-api-go/pkg/metrics"
+)
+
+func TestWriteQueueMetrics(t *testing.T) {
+	srv := tickerServer(t)
+	defer srv.Close()
+
+	reg := metrics.NewRegistry()
+	p := NewDefaultParameters()
+	p.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	p.Metrics = reg
+	ws := NewWithParams(p)
+	require.Nil(t, ws.Connect())
+	defer ws.Close()
+	_, err := ws.SubscribeTicker(context.Background(), "tBTCUSD")
+	require.Nil(t, err)
+	nextEvent(t, ws.Listen(), isTick)
+
+	// the queue is drained once the subscribe request is written
+	require.Eventually(t, func() bool {
+		var out bytes.Buffer
+		require.Nil(t, reg.Write(&out))
+		return strings.Contains(out.String(), `bfx_ws_write_queue_depth{socket_id="0"} 0`)
+	}, time.Second, time.Millisecond*10)
+}